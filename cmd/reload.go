@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"github.com/bhargavparmar/hive-demo/pkg/logger"
+	"github.com/bhargavparmar/hive-demo/pkg/tasks"
+	"github.com/cilium/hive/cell"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	// configFile is the configuration file given with --config, empty when
+	// settings only come from flags and the environment
+	configFile string
+
+	// settings and flags are the hive's effective settings and the
+	// command-line flags, set by Execute. The reload cannot refer to h
+	// directly, as h is built from the cells.
+	settings *viper.Viper
+	flags    *pflag.FlagSet
+)
+
+// reloadFunc applies the new value of a setting to the running application
+type reloadFunc func(v *viper.Viper, tm tasks.TaskManager) error
+
+// reloadable are the settings applied by a SIGHUP reload, keyed by flag
+// name. Changing any other setting in the configuration file requires a
+// restart.
+var reloadable = map[string]reloadFunc{
+	"log-level": func(v *viper.Viper, _ tasks.TaskManager) error {
+		return setLogLevel(v.GetString("log-level"))
+	},
+	"task-create-rate-per-assignee": func(v *viper.Viper, tm tasks.TaskManager) error {
+		return tm.SetCreateRatePerAssignee(v.GetInt("task-create-rate-per-assignee"))
+	},
+}
+
+// reloadCell re-reads the configuration file when the process receives
+// SIGHUP
+var reloadCell = cell.Invoke(registerReload)
+
+// setLogLevel sets the minimum level of the messages logged
+func setLogLevel(name string) error {
+	level, err := logger.ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	logLevelVar.Set(level)
+	return nil
+}
+
+func registerReload(lc cell.Lifecycle, logger *slog.Logger, tm tasks.TaskManager) {
+	if configFile == "" {
+		return
+	}
+
+	logger = logger.With("component", "config-reload")
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	lc.Append(cell.Hook{
+		OnStart: func(ctx cell.HookContext) error {
+			signal.Notify(signals, syscall.SIGHUP)
+			go func() {
+				defer close(done)
+				for range signals {
+					reload(logger, tm)
+				}
+			}()
+			logger.Info("Reloading configuration on SIGHUP", "file", configFile)
+			return nil
+		},
+		OnStop: func(ctx cell.HookContext) error {
+			signal.Stop(signals)
+			close(signals)
+			<-done
+			return nil
+		},
+	})
+}
+
+// reload re-reads the configuration file and applies the reloadable
+// settings that changed. Settings given on the command line take precedence
+// over the file, as they do on startup, and settings removed from the file
+// keep their current value.
+func reload(logger *slog.Logger, tm tasks.TaskManager) {
+	logger.Info("Reloading configuration", "file", configFile)
+
+	file := viper.New()
+	file.SetConfigFile(configFile)
+	if err := file.ReadInConfig(); err != nil {
+		logger.Error("Configuration reload failed", "error", err)
+		return
+	}
+
+	keys := file.AllKeys()
+	slices.Sort(keys)
+
+	applied := 0
+	for _, key := range keys {
+		if fmt.Sprint(file.Get(key)) == fmt.Sprint(settings.Get(key)) {
+			continue
+		}
+		if flag := flags.Lookup(key); flag != nil && flag.Changed {
+			logger.Warn("Setting is overridden by a command-line flag", "setting", key)
+			continue
+		}
+
+		apply, ok := reloadable[key]
+		if !ok {
+			logger.Warn("Setting changed but requires a restart", "setting", key)
+			continue
+		}
+		if err := apply(file, tm); err != nil {
+			logger.Error("Setting not reloaded", "setting", key, "error", err)
+			continue
+		}
+		settings.Set(key, file.Get(key))
+		logger.Info("Setting reloaded", "setting", key, "value", file.Get(key))
+		applied++
+	}
+
+	logger.Info("Configuration reloaded", "applied", applied)
+}
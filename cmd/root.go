@@ -3,13 +3,20 @@ package cmd
 import (
 	"fmt"
 	"log/slog"
+	"math"
 	"os"
 
 	"github.com/bhargavparmar/hive-demo/pkg/api"
+	"github.com/bhargavparmar/hive-demo/pkg/clock"
 	"github.com/bhargavparmar/hive-demo/pkg/database"
+	"github.com/bhargavparmar/hive-demo/pkg/idgen"
+	"github.com/bhargavparmar/hive-demo/pkg/logger"
 	"github.com/bhargavparmar/hive-demo/pkg/metrics"
 	"github.com/bhargavparmar/hive-demo/pkg/storage"
 	"github.com/bhargavparmar/hive-demo/pkg/tasks"
+	"github.com/bhargavparmar/hive-demo/pkg/tracing"
+	"github.com/bhargavparmar/hive-demo/pkg/webhooks"
+	"github.com/bhargavparmar/hive-demo/pkg/workers"
 	"github.com/cilium/hive"
 	"github.com/cilium/hive/cell"
 	"github.com/spf13/cobra"
@@ -23,9 +30,16 @@ var (
 
 		// Infrastructure layer - external dependencies
 		// Note: Logger is provided automatically by Hive
+		tracing.Cell,
 		database.Cell,
 		storage.Cell,
 		metrics.Cell,
+		idgen.Cell,
+		clock.Cell,
+		workers.Cell,
+		webhooks.Cell,
+		// The log level, adjustable while running
+		cell.Provide(func() *slog.LevelVar { return logLevelVar }),
 
 		// Business logic layer
 		tasks.Cell,
@@ -35,11 +49,18 @@ var (
 
 		// Invoke ensures the API server is constructed and started
 		cell.Invoke(func(api.Server) {}),
+
+		reloadCell,
 	)
 
 	// h is the Hive instance shared between commands
 	h = hive.New(App)
 
+	// logLevel is the minimum level of the messages logged, as given by
+	// --log-level, and logLevelVar the level in effect
+	logLevel    string
+	logLevelVar = new(slog.LevelVar)
+
 	// rootCmd is the main command for the application
 	rootCmd = &cobra.Command{
 		Use:   "task-manager",
@@ -55,8 +76,23 @@ It includes:
 
 All components are wired together using Hive's dependency injection.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			// Create a basic logger for Hive
-			log := slog.Default()
+			if configFile != "" {
+				h.Viper().SetConfigFile(configFile)
+				if err := h.Viper().ReadInConfig(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: reading config file: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			if err := setLogLevel(h.Viper().GetString("log-level")); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			// Create a basic logger for Hive. The default handler passes
+			// every record on, leaving the level to logLevelVar.
+			slog.SetLogLoggerLevel(math.MinInt)
+			log := slog.New(logger.NewLevelHandler(slog.Default().Handler(), logLevelVar))
 
 			// Run the hive (start all components, wait for interrupt)
 			if err := h.Run(log); err != nil {
@@ -71,6 +107,13 @@ All components are wired together using Hive's dependency injection.`,
 func Execute() {
 	// Register all flags from cells
 	h.RegisterFlags(rootCmd.Flags())
+	rootCmd.Flags().StringVar(&logLevel, "log-level", "info", "Minimum log level (debug, info, warn, error)")
+	rootCmd.Flags().StringVar(&configFile, "config", "", "Configuration file (YAML, JSON or TOML) with settings named like the flags; reloaded on SIGHUP")
+	// Let the config file set the log level too
+	if err := h.Viper().BindPFlag("log-level", rootCmd.Flags().Lookup("log-level")); err != nil {
+		panic(err)
+	}
+	settings, flags = h.Viper(), rootCmd.Flags()
 
 	// Add hive inspection command
 	rootCmd.AddCommand(h.Command())
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/bhargavparmar/hive-demo/pkg/api"
+	"github.com/bhargavparmar/hive-demo/pkg/storage"
+	"github.com/cilium/hive"
+	"github.com/cilium/hive/cell"
+)
+
+// freePort returns a local TCP port that nothing listens on
+func freePort(tb testing.TB) int {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestAPIDisabledBindsNoPort(t *testing.T) {
+	port, adminPort := freePort(t), freePort(t)
+
+	var srv api.Server
+	h := hive.New(App, cell.Invoke(func(s api.Server) { srv = s }))
+	hive.AddConfigOverride(h, func(cfg *api.Config) {
+		cfg.Enabled = false
+		cfg.Host = "127.0.0.1"
+		cfg.Port = port
+		cfg.AdminPort = adminPort
+	})
+	hive.AddConfigOverride(h, func(cfg *storage.Config) { cfg.Backend = storage.BackendMemory })
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := h.Start(log, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := h.Stop(log, context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if addrs := srv.Address(); len(addrs) != 0 {
+		t.Fatalf("got addresses %v, want none", addrs)
+	}
+	for _, p := range []int{port, adminPort} {
+		addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(p))
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			t.Fatalf("something listens on %s", addr)
+		}
+	}
+}
@@ -1,18 +1,33 @@
 package api
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bhargavparmar/hive-demo/pkg/database"
+	"github.com/bhargavparmar/hive-demo/pkg/logger"
 	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+	"github.com/bhargavparmar/hive-demo/pkg/storage"
 	"github.com/bhargavparmar/hive-demo/pkg/tasks"
+	"github.com/bhargavparmar/hive-demo/pkg/webhooks"
 	"github.com/cilium/hive/cell"
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Cell provides HTTP API server
@@ -21,118 +36,444 @@ var Cell = cell.Module(
 	"HTTP API Server",
 
 	cell.Config(defaultConfig),
-	cell.Provide(newServer),
+	metrics.TimeHooks(
+		cell.Provide(newServer),
+	),
 )
 
+// Version is the build version reported on the root endpoint. Release builds
+// set it with -ldflags "-X github.com/bhargavparmar/hive-demo/pkg/api.Version=v1.2.3".
+var Version = "1.0.0"
+
 // Config holds API server configuration
 type Config struct {
-	Port int    `mapstructure:"api-port"`
-	Host string `mapstructure:"api-host"`
+	Enabled         bool          `mapstructure:"api-enabled"`
+	Port            int           `mapstructure:"api-port"`
+	Host            string        `mapstructure:"api-host"`
+	Listen          []string      `mapstructure:"api-listen"`
+	BasePath        string        `mapstructure:"api-base-path"`
+	RequestTimeout  time.Duration `mapstructure:"api-request-timeout"`
+	ShutdownTimeout time.Duration `mapstructure:"api-shutdown-timeout"`
+	PrettyJSON      bool          `mapstructure:"api-pretty-json"`
+	EnablePprof     bool          `mapstructure:"api-enable-pprof"`
+	MaxBodyBytes    int64         `mapstructure:"api-max-body-bytes"`
+	RequestLogSize  int           `mapstructure:"api-request-log-size"`
+	AdminPort       int           `mapstructure:"admin-port"`
+	AllowFlush      bool          `mapstructure:"allow-flush"`
+
+	ServiceName        string `mapstructure:"api-service-name"`
+	ServiceDescription string `mapstructure:"api-service-description"`
+	ServiceContact     string `mapstructure:"api-service-contact"`
+
+	SlowRequestThreshold time.Duration `mapstructure:"api-slow-request-threshold"`
+
+	StorageDegradedPercent float64       `mapstructure:"api-storage-degraded-percent"`
+	HealthCacheInterval    time.Duration `mapstructure:"api-health-cache-interval"`
+
+	LogBodies       bool `mapstructure:"api-log-bodies"`
+	LogBodyMaxBytes int  `mapstructure:"api-log-body-max-bytes"`
+
+	GzipLevel string `mapstructure:"api-gzip-level"`
+
+	MaxConcurrent int `mapstructure:"api-max-concurrent"`
 }
 
 var defaultConfig = Config{
-	Port: 8080,
-	Host: "localhost",
+	Enabled:         true,
+	Port:            8080,
+	Host:            "localhost",
+	Listen:          nil,
+	BasePath:        "",
+	RequestTimeout:  5 * time.Second,
+	ShutdownTimeout: 5 * time.Second,
+	PrettyJSON:      false,
+	EnablePprof:     false,
+	MaxBodyBytes:    1 << 20,
+	RequestLogSize:  100,
+	AdminPort:       0,
+	AllowFlush:      false,
+
+	ServiceName:        "Task Manager API",
+	ServiceDescription: "",
+	ServiceContact:     "",
+
+	SlowRequestThreshold: time.Second,
+
+	StorageDegradedPercent: 90,
+	HealthCacheInterval:    time.Second,
+
+	LogBodies:       false,
+	LogBodyMaxBytes: 1024,
+
+	GzipLevel: gzipOff,
+
+	MaxConcurrent: 0,
 }
 
 // Flags implements cell.Flagger
 func (c Config) Flags(flags *pflag.FlagSet) {
+	flags.Bool("api-enabled", c.Enabled, "Serve the HTTP API. When false the server is still built, so cells depending on it resolve, but no port is bound, e.g. for worker-only deployments")
 	flags.Int("api-port", c.Port, "API server port")
 	flags.String("api-host", c.Host, "API server host")
+	flags.StringSlice("api-listen", c.Listen, "Address (host:port) to listen on; repeat to listen on several. Overrides --api-host and --api-port")
+	flags.String("api-base-path", c.BasePath, "Path prefix to serve the API under, e.g. /api when mounted behind a reverse proxy (empty serves at the root)")
+	flags.Duration("api-request-timeout", c.RequestTimeout, "Maximum time to handle a request before responding with 503 (0 disables)")
+	flags.Duration("api-shutdown-timeout", c.ShutdownTimeout, "Maximum time to wait on shutdown for in-flight requests to finish before the storage and database are stopped")
+	flags.Bool("api-pretty-json", c.PrettyJSON, "Indent JSON responses by default (overridable per request with ?pretty=)")
+	flags.Int64("api-max-body-bytes", c.MaxBodyBytes, "Maximum request body size in bytes; larger requests get 413 (0 disables)")
+	flags.Duration("api-slow-request-threshold", c.SlowRequestThreshold, "Log requests taking longer than this at warn level with slow=true (0 disables)")
+	flags.Float64("api-storage-degraded-percent", c.StorageDegradedPercent, "Report the service as degraded in /health when bounded storage is fuller than this percentage")
+	flags.Duration("api-health-cache-interval", c.HealthCacheInterval, "How often the dependencies reported by /health are checked in the background; probes reuse the last result (0 checks on every probe)")
+	flags.Bool("api-log-bodies", c.LogBodies, "Log request and response bodies at debug level, with sensitive fields redacted. Bodies may contain personal data")
+	flags.Int("api-log-body-max-bytes", c.LogBodyMaxBytes, "Maximum number of bytes of each body logged by --api-log-bodies")
+	flags.String("api-gzip-level", c.GzipLevel, "Compress responses for clients accepting gzip at this level: 1 (fastest) to 9 (smallest), best-speed, best-compression, default, or off")
+	flags.Int("api-max-concurrent", c.MaxConcurrent, "Maximum requests handled at once; further requests get 503 with Retry-After. Streaming, health and admin requests are not limited (0 disables)")
+	flags.String("api-service-name", c.ServiceName, "Service name shown on the root endpoint")
+	flags.String("api-service-description", c.ServiceDescription, "Service description shown on the root endpoint")
+	flags.String("api-service-contact", c.ServiceContact, "Contact information, such as a team or email address, shown on the root endpoint")
+	flags.Int("admin-port", c.AdminPort, "Serve the /admin/ and /debug/pprof/ routes on this port instead of the API port (0 keeps them on the API port)")
+	flags.Bool("allow-flush", c.AllowFlush, "Allow DELETE /admin/tasks to delete every task. Only meant for test environments")
+	flags.Int("api-request-log-size", c.RequestLogSize, "Number of recent requests kept for GET /admin/requests (0 disables)")
+	flags.Bool("api-enable-pprof", c.EnablePprof, "Serve Go profiling data under /debug/pprof/. Profiles expose memory contents, goroutine stacks and the command line and are unauthenticated, so only enable this on a trusted network")
 }
 
 // Server represents the HTTP API server
 type Server interface {
-	Address() string
+	// Address returns the addresses the server listens on. Once started
+	// these are the bound addresses, with any port 0 resolved. It is empty
+	// when the API is disabled.
+	Address() []string
+	// Handler returns the server's HTTP handler, including all middleware
+	Handler() http.Handler
 }
 
 type server struct {
 	cfg         Config
 	logger      *slog.Logger
 	taskManager tasks.TaskManager
+	storage     storage.Storage
+	db          database.Database
 	metrics     metrics.Metrics
+	webhooks    webhooks.Dispatcher
+	logLevel    *slog.LevelVar
+	tracer      trace.Tracer
 	httpServer  *http.Server
+	// adminServer serves the admin routes on their own port, nil when they
+	// share the public server
+	adminServer *http.Server
+
+	mu        sync.Mutex
+	addresses []string
+
+	// maintenance rejects mutating requests while set
+	maintenance atomic.Bool
+	// draining rejects all new requests once set; it is never cleared
+	draining atomic.Bool
+	// serving is set when the server starts to serve, and started once it
+	// has finished starting; started is cleared again when it begins to
+	// stop. See ready.
+	serving atomic.Bool
+	started atomic.Bool
+	// inFlight counts the requests being handled, excluding health checks
+	// and admin requests
+	inFlight atomic.Int64
+
+	// startedAt is when the server started serving. All reported uptimes
+	// are measured from it.
+	startedAt time.Time
+
+	// requestLog holds the most recent requests, nil when disabled
+	requestLog *requestLog
+
+	// gzip holds the writers compressing responses, nil when disabled
+	gzip *gzipPool
+
+	// concurrency holds a slot for each request being handled under the
+	// concurrency limit, nil when there is no limit
+	concurrency chan struct{}
+
+	// health is the latest dependency check, nil before the first
+	health atomic.Pointer[healthCheck]
+	// stopMonitor stops the background health checks, nil when they are
+	// not running
+	stopMonitor context.CancelFunc
+	monitorDone chan struct{}
 }
 
 // newServer creates a new HTTP API server with all dependencies
-func newServer(lc cell.Lifecycle, cfg Config, logger *slog.Logger, tm tasks.TaskManager, m metrics.Metrics) Server {
+func newServer(lc cell.Lifecycle, cfg Config, logger *slog.Logger, tm tasks.TaskManager, st storage.Storage, db database.Database, m metrics.Metrics, hooks webhooks.Dispatcher, level *slog.LevelVar, tp trace.TracerProvider) (Server, error) {
+	if cfg.StorageDegradedPercent <= 0 || cfg.StorageDegradedPercent > 100 {
+		return nil, fmt.Errorf("api-storage-degraded-percent must be in (0, 100], got %g", cfg.StorageDegradedPercent)
+	}
+	cfg.BasePath = normalizeBasePath(cfg.BasePath)
+	if cfg.HealthCacheInterval < 0 {
+		return nil, fmt.Errorf("api-health-cache-interval must not be negative, got %s", cfg.HealthCacheInterval)
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		return nil, fmt.Errorf("api-shutdown-timeout must be positive, got %s", cfg.ShutdownTimeout)
+	}
+	if cfg.MaxConcurrent < 0 {
+		return nil, fmt.Errorf("api-max-concurrent must not be negative, got %d", cfg.MaxConcurrent)
+	}
+	gzip, err := newGzipPool(cfg.GzipLevel)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &server{
 		cfg:         cfg,
 		logger:      logger.With("component", "api-server"),
 		taskManager: tm,
+		storage:     st,
+		db:          db,
 		metrics:     m,
+		webhooks:    hooks,
+		logLevel:    level,
+		tracer:      tp.Tracer("api"),
+		gzip:        gzip,
+		// Replaced in OnStart; covers handlers served without starting
+		startedAt: time.Now(),
+	}
+
+	if cfg.RequestLogSize > 0 {
+		s.requestLog = newRequestLog(cfg.RequestLogSize)
+	}
+	if cfg.MaxConcurrent > 0 {
+		s.concurrency = make(chan struct{}, cfg.MaxConcurrent)
 	}
 
 	// Setup HTTP routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleRoot)
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
 	mux.HandleFunc("/tasks", s.handleTasks)
-	mux.HandleFunc("/tasks/", s.handleTaskByID)
+
+	// The fixed paths under /tasks/ take precedence over task IDs, so no
+	// task may be created with one of their names
+	fixedTaskRoutes := map[string]http.HandlerFunc{
+		"count":        s.handleTaskCount,
+		"bulk-status":  s.handleBulkStatus,
+		"upsert":       s.handleUpsert,
+		"validate":     s.handleValidate,
+		"order":        s.handleSetOrders,
+		"import.csv":   s.handleImportCSV,
+		"stream":       s.handleTaskStream,
+		"autocomplete": s.handleAutocomplete,
+		"facets":       s.handleFacets,
+	}
+	for name, handler := range fixedTaskRoutes {
+		mux.HandleFunc("/tasks/"+name, handler)
+		tm.ReserveIDs(name)
+	}
+	mux.HandleFunc("/tasks/{$}", s.handleMissingTaskID)
+	mux.HandleFunc("/tasks/{id}", s.handleTaskByID)
+	mux.HandleFunc("/tasks/{id}/{action}", s.handleTaskAction)
+	mux.HandleFunc("/tasks/{id}/move", s.handleMove)
+	mux.HandleFunc("/tasks/{id}/duplicate", s.handleDuplicate)
+	mux.HandleFunc("/tasks/{id}/watchers/{watcher}", s.handleWatcher)
+	mux.HandleFunc("/tasks/{id}/claim", s.handleClaim)
 	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/stats/effort", s.handleEffort)
+	mux.HandleFunc("/stats/timeseries", s.handleTimeSeries)
+	mux.HandleFunc("/metrics", s.handleMetrics)
 
+	// Admin routes move to their own server when an admin port is set
+	adminMux := mux
+	if cfg.AdminPort > 0 {
+		adminMux = http.NewServeMux()
+	}
+	adminMux.HandleFunc("/admin/maintenance", s.handleMaintenance)
+	adminMux.HandleFunc("/admin/drain", s.handleDrain)
+	adminMux.HandleFunc("/admin/metrics/pause", s.handleMetricsPause)
+	adminMux.HandleFunc("/admin/requests", s.handleRequestLog)
+	adminMux.HandleFunc("/admin/webhooks/dead-letter", s.handleDeadLetters)
+	adminMux.HandleFunc("/admin/log-level", s.handleLogLevel)
+	adminMux.HandleFunc("/admin/tasks", s.handleFlush)
+
+	if cfg.EnablePprof {
+		adminMux.HandleFunc("/debug/pprof/", pprof.Index)
+		adminMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		adminMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		adminMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		adminMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		s.logger.Warn("Profiling endpoints enabled", "path", "/debug/pprof/")
+	}
+
+	s.addresses = cfg.Listen
+	if len(s.addresses) == 0 {
+		s.addresses = []string{net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))}
+	}
+
+	chain := s.defaultChain()
 	s.httpServer = &http.Server{
-		Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Handler:      s.loggingMiddleware(mux),
+		Handler:      mountAt(cfg.BasePath, s.routed(chain, mux)),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
 
+	if cfg.AdminPort > 0 {
+		s.adminServer = &http.Server{
+			Addr:         net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.AdminPort)),
+			Handler:      mountAt(cfg.BasePath, s.routed(chain, adminMux)),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+	}
+
 	lc.Append(cell.Hook{
 		OnStart: func(ctx cell.HookContext) error {
-			s.logger.Info("Starting API server", "address", s.httpServer.Addr)
+			if !s.cfg.Enabled {
+				s.logger.Info("API server disabled, not listening")
+				return nil
+			}
+			s.logger.Info("Starting API server", "addresses", s.addresses)
+
+			// Bind every address before serving so that a bad address
+			// fails startup instead of leaving a partially reachable server
+			addrs := s.addresses
+			if s.adminServer != nil {
+				addrs = append(slices.Clone(addrs), s.adminServer.Addr)
+			}
 
-			go func() {
-				if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-					s.logger.Error("API server error", "error", err)
+			listeners := make([]net.Listener, 0, len(addrs))
+			for _, addr := range addrs {
+				ln, err := net.Listen("tcp", addr)
+				if err != nil {
+					for _, l := range listeners {
+						l.Close()
+					}
+					return fmt.Errorf("listening on %s: %w", addr, err)
 				}
-			}()
+				listeners = append(listeners, ln)
+			}
+
+			public := listeners[:len(s.addresses)]
+			bound := make([]string, len(public))
+			for i, ln := range public {
+				bound[i] = ln.Addr().String()
+			}
+
+			s.mu.Lock()
+			s.addresses = bound
+			s.mu.Unlock()
 
-			s.logger.Info("API server started successfully", "url", fmt.Sprintf("http://%s", s.httpServer.Addr))
+			// Set before serving, so handlers always see it
+			s.startedAt = time.Now()
+
+			s.serving.Store(true)
+
+			// All public listeners share the one http.Server, so Shutdown
+			// stops them together
+			for _, ln := range public {
+				s.serve(s.httpServer, ln)
+				s.logger.Info("API server started successfully", "url", fmt.Sprintf("http://%s", ln.Addr()))
+			}
+			if s.adminServer != nil {
+				ln := listeners[len(listeners)-1]
+				s.serve(s.adminServer, ln)
+				s.logger.Info("Admin server started successfully", "url", fmt.Sprintf("http://%s", ln.Addr()))
+			}
+
+			if s.cfg.HealthCacheInterval > 0 {
+				ctx, cancel := context.WithCancel(context.Background())
+				s.stopMonitor = cancel
+				s.monitorDone = make(chan struct{})
+				go func() {
+					defer close(s.monitorDone)
+					s.monitorHealth(ctx)
+				}()
+			}
+
+			s.started.Store(true)
 			return nil
 		},
 		OnStop: func(ctx cell.HookContext) error {
+			if !s.cfg.Enabled {
+				return nil
+			}
 			s.logger.Info("Stopping API server...")
-			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			s.started.Store(false)
+			if s.stopMonitor != nil {
+				s.stopMonitor()
+				<-s.monitorDone
+			}
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
 			defer cancel()
 
+			if s.adminServer != nil {
+				if err := s.adminServer.Shutdown(shutdownCtx); err != nil {
+					s.logger.Error("Error shutting down admin server", "error", err)
+				}
+			}
+
 			if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
 				s.logger.Error("Error shutting down server", "error", err)
 				return err
 			}
 
+			// The storage and database stop after this hook returns, so
+			// wait for handlers that outlived their connection too
+			if err := s.waitForRequests(shutdownCtx); err != nil {
+				s.logger.Error("Stopping with requests still in flight", "error", err)
+				return err
+			}
+
 			s.logger.Info("API server stopped")
 			return nil
 		},
 	})
 
-	return s
+	return s, nil
 }
 
-func (s *server) Address() string {
-	return s.httpServer.Addr
+// waitForRequests waits until no request is being handled or ctx is done.
+// Handlers cut off by the request timeout keep running after their response
+// is sent, so a shut down server may still have some in flight.
+func (s *server) waitForRequests(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		n := s.inFlight.Load()
+		if n <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d requests in flight: %w", n, ctx.Err())
+		case <-ticker.C:
+		}
+	}
 }
 
-// Middleware for logging requests
-func (s *server) loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		s.metrics.IncrementRequests()
+// serve serves srv on ln in the background
+func (s *server) serve(srv *http.Server, ln net.Listener) {
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("API server error", "address", ln.Addr(), "error", err)
+		}
+	}()
+}
 
-		s.logger.Info("Request",
-			"method", r.Method,
-			"path", r.URL.Path,
-			"remote", r.RemoteAddr,
-		)
+// routed wraps mux in the middleware chain, counting and tracing requests by
+// the route of mux they match
+func (s *server) routed(chain Chain, mux *http.ServeMux) http.Handler {
+	return NewChain(s.routeMetricsMiddleware(mux), s.tracingMiddleware(mux)).Append(chain...).Then(mux)
+}
 
-		next.ServeHTTP(w, r)
+func (s *server) Address() []string {
+	if !s.cfg.Enabled {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.addresses)
+}
 
-		s.logger.Info("Response",
-			"method", r.Method,
-			"path", r.URL.Path,
-			"duration", time.Since(start),
-		)
-	})
+func (s *server) Handler() http.Handler {
+	return s.httpServer.Handler
 }
 
 func (s *server) handleRoot(w http.ResponseWriter, r *http.Request) {
@@ -142,127 +483,1380 @@ func (s *server) handleRoot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := map[string]interface{}{
-		"service": "Task Manager API",
-		"version": "1.0.0",
-		"endpoints": map[string]string{
-			"GET /health":       "Health check",
-			"GET /stats":        "Get statistics",
-			"GET /tasks":        "List all tasks",
-			"POST /tasks":       "Create a new task",
-			"GET /tasks/{id}":   "Get a specific task",
-			"PUT /tasks/{id}":   "Update a task",
-			"DELETE /tasks/{id}": "Delete a task",
-		},
+		"service":   s.cfg.ServiceName,
+		"version":   Version,
+		"endpoints": s.endpoints(),
+	}
+
+	s.addUptime(response)
+	if s.cfg.ServiceDescription != "" {
+		response["description"] = s.cfg.ServiceDescription
+	}
+	if s.cfg.ServiceContact != "" {
+		response["contact"] = s.cfg.ServiceContact
 	}
 
 	s.jsonResponse(w, http.StatusOK, response)
 }
 
-func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	response := map[string]string{
-		"status": "healthy",
-		"time":   time.Now().Format(time.RFC3339),
+// rootEndpoints describes the routes listed by the root endpoint, keyed by
+// method and path relative to the base path
+var rootEndpoints = map[string]string{
+	"GET /health":                           "Health check",
+	"GET /readyz":                           "Readiness check; 503 until the server may take writes",
+	"GET /stats":                            "Get statistics",
+	"GET /stats/effort":                     "Sum the estimated and spent time of tasks",
+	"GET /stats/timeseries":                 "Count tasks created or updated per time bucket",
+	"GET /metrics":                          "Metrics in Prometheus or OpenMetrics format",
+	"GET /tasks":                            "List all tasks",
+	"GET /tasks/count":                      "Count tasks",
+	"GET /tasks/stream":                     "Export tasks as newline-delimited JSON",
+	"GET /tasks/autocomplete":               "Suggest task titles matching a query",
+	"GET /tasks/facets":                     "Count tasks by each status, assignee and label in use",
+	"POST /tasks":                           "Create a new task",
+	"POST /tasks/bulk-status":               "Set the status of several tasks",
+	"POST /tasks/upsert":                    "Create or update several tasks by ID",
+	"POST /tasks/validate":                  "Validate tasks without creating them",
+	"PATCH /tasks/order":                    "Set the order of several tasks at once",
+	"POST /tasks/import.csv":                "Create tasks from a CSV file",
+	"GET /tasks/{id}":                       "Get a specific task",
+	"PUT /tasks/{id}":                       "Update a task",
+	"PATCH /tasks/{id}":                     "Apply a JSON merge patch to a task",
+	"DELETE /tasks/{id}":                    "Delete a task",
+	"GET /admin/maintenance":                "Get the maintenance mode state",
+	"GET /admin/drain":                      "Get the drain state and in-flight request count",
+	"POST /admin/drain":                     "Stop accepting new requests",
+	"POST /admin/maintenance":               "Turn maintenance mode on or off",
+	"GET /admin/metrics/pause":              "Get whether metrics collection is paused",
+	"POST /admin/metrics/pause":             "Pause or resume metrics collection",
+	"GET /admin/requests":                   "List the most recent requests",
+	"GET /admin/webhooks/dead-letter":       "List webhook deliveries that failed every attempt",
+	"GET /admin/log-level":                  "Get the minimum level of logged messages",
+	"PUT /admin/log-level":                  "Change the minimum level of logged messages",
+	"DELETE /admin/tasks":                   "Delete every task, if --allow-flush is set",
+	"POST /tasks/{id}/archive":              "Archive a task",
+	"POST /tasks/{id}/unarchive":            "Restore an archived task",
+	"POST /tasks/{id}/star":                 "Star a task",
+	"POST /tasks/{id}/move":                 "Move a task within its status",
+	"POST /tasks/{id}/duplicate":            "Create a copy of a task",
+	"DELETE /tasks/{id}/star":               "Remove the star from a task",
+	"PUT /tasks/{id}/watchers/{watcher}":    "Add a watcher to a task",
+	"DELETE /tasks/{id}/watchers/{watcher}": "Remove a watcher from a task",
+	"POST /tasks/{id}/claim":                "Claim a task for a worker for a limited time",
+	"DELETE /tasks/{id}/claim":              "Release a worker's claim on a task",
+}
+
+// endpoints returns rootEndpoints with the base path applied
+func (s *server) endpoints() map[string]string {
+	endpoints := make(map[string]string, len(rootEndpoints))
+	for route, desc := range rootEndpoints {
+		method, path, _ := strings.Cut(route, " ")
+		endpoints[method+" "+s.link(path)] = desc
 	}
-	s.jsonResponse(w, http.StatusOK, response)
+	return endpoints
+}
+
+// link returns the URL path of a route, including the base path
+func (s *server) link(path string) string {
+	return s.cfg.BasePath + path
+}
+
+// addUptime adds the time since the server started to response, both as a
+// duration string and in whole seconds
+func (s *server) addUptime(response map[string]interface{}) {
+	uptime := time.Since(s.startedAt)
+	response["uptime"] = uptime.Truncate(time.Second).String()
+	response["uptime_seconds"] = int64(uptime.Seconds())
 }
 
 func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
-	stats := s.taskManager.GetStats()
+	stats, err := s.taskManager.GetStats(r.Context())
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+	s.addUptime(stats)
+	if s.concurrency != nil {
+		stats["concurrency"] = map[string]int{
+			"in_flight": len(s.concurrency),
+			"limit":     cap(s.concurrency),
+		}
+	}
 	s.jsonResponse(w, http.StatusOK, stats)
 }
 
+// handleEffort sums the estimated and spent time of the unarchived tasks,
+// only those of one assignee with ?assignee=
+func (s *server) handleEffort(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, readMethods) {
+		return
+	}
+
+	assignee := r.URL.Query().Get("assignee")
+	effort, err := s.taskManager.Effort(r.Context(), assignee)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{"effort": effort}
+	if assignee != "" {
+		response["assignee"] = assignee
+	}
+	s.jsonResponse(w, http.StatusOK, response)
+}
+
+// timeSeriesIntervals are the named intervals of /stats/timeseries
+var timeSeriesIntervals = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+// defaultTimeSeriesBuckets is the number of buckets covered when no start
+// is given
+const defaultTimeSeriesBuckets = 30
+
+// handleTimeSeries counts tasks per time bucket, such as tasks created per
+// day, for trend charts
+func (s *server) handleTimeSeries(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, readMethods) {
+		return
+	}
+
+	q := r.URL.Query()
+	field := cmp.Or(q.Get("field"), tasks.TimeSeriesCreated)
+
+	name := cmp.Or(q.Get("interval"), "day")
+	interval, ok := timeSeriesIntervals[name]
+	if !ok {
+		var err error
+		if interval, err = time.ParseDuration(name); err != nil {
+			s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+			s.jsonError(w, http.StatusBadRequest, codeBadRequest, "Invalid value for interval: "+name+"; must be hour, day, week or a duration such as 6h")
+			return
+		}
+	}
+
+	to, err := timeSeriesBound(q.Get("to"), time.Now())
+	if err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonError(w, http.StatusBadRequest, codeBadRequest, "Invalid value for to: "+err.Error())
+		return
+	}
+	from, err := timeSeriesBound(q.Get("from"), to.Add(-defaultTimeSeriesBuckets*interval))
+	if err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonError(w, http.StatusBadRequest, codeBadRequest, "Invalid value for from: "+err.Error())
+		return
+	}
+
+	buckets, err := s.taskManager.TimeSeries(r.Context(), field, interval, from, to)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	total := 0
+	for _, b := range buckets {
+		total += b.Count
+	}
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"field":            field,
+		"interval_seconds": int64(interval.Seconds()),
+		"total":            total,
+		"buckets":          buckets,
+	})
+}
+
+// timeSeriesBound parses a /stats/timeseries bound, an RFC 3339 timestamp
+// or a date taken as midnight UTC, returning def if it is empty
+func timeSeriesBound(v string, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s; must be an RFC 3339 timestamp or a date such as 2026-01-31", v)
+	}
+	return t, nil
+}
+
+// Methods supported by the task routes, as advertised in the Allow header
+var (
+	adminMethods    = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions}
+	tasksMethods    = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions}
+	readMethods     = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+	actionMethods   = []string{http.MethodPost, http.MethodOptions}
+	starMethods     = []string{http.MethodPost, http.MethodDelete, http.MethodOptions}
+	watcherMethods  = []string{http.MethodPut, http.MethodDelete, http.MethodOptions}
+	claimMethods    = starMethods
+	orderMethods    = []string{http.MethodPatch, http.MethodOptions}
+	flushMethods    = []string{http.MethodDelete, http.MethodOptions}
+	settingMethods  = []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodOptions}
+	taskByIDMethods = []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+)
+
+// handleMethods answers OPTIONS requests and rejects methods that are not in
+// allowed. It reports whether the request has been handled.
+func (s *server) handleMethods(w http.ResponseWriter, r *http.Request, allowed []string) bool {
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+
+	if !slices.Contains(allowed, r.Method) {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		s.jsonError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+		return true
+	}
+
+	return false
+}
+
 func (s *server) handleTasks(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, tasksMethods) {
+		return
+	}
+
+	// HEAD is served like GET; net/http discards the body
 	switch r.Method {
-	case http.MethodGet:
-		tasks := s.taskManager.List()
-		s.jsonResponse(w, http.StatusOK, tasks)
+	case http.MethodGet, http.MethodHead:
+		fields, ok := s.fieldSelection(w, r)
+		if !ok {
+			return
+		}
+		p, paginate, err := pageParams(r)
+		if err != nil {
+			s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+			s.jsonError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
 
-	case http.MethodPost:
-		var req struct {
-			Title       string `json:"title"`
-			Description string `json:"description"`
+		// Taken before listing, so a write in between changes the tag of
+		// the next request rather than being hidden behind this one
+		tag := s.listETag()
+		w.Header().Set("ETag", tag)
+		if noneMatch(r, tag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		tasks, ok := s.listTasks(w, r)
+		if !ok {
+			return
+		}
+		if paginate {
+			s.pageResponse(w, r, tasks, fields, p)
+			return
 		}
+		s.streamTasks(w, r, tasks, fields)
 
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			s.metrics.IncrementErrors()
-			s.jsonError(w, http.StatusBadRequest, "Invalid request body")
+	case http.MethodPost:
+		var req createRequest
+
+		if err := s.decodeJSON(w, r, &req); err != nil {
+			s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+			s.decodeErrorResponse(w, err)
 			return
 		}
 
-		task, err := s.taskManager.Create(req.Title, req.Description)
+		task, err := s.taskManager.Create(r.Context(), req.params())
 		if err != nil {
-			s.metrics.IncrementErrors()
-			s.jsonError(w, http.StatusBadRequest, err.Error())
+			s.metrics.IncrementErrorsByType(errorType(err))
+			s.taskError(w, err)
 			return
 		}
 
-		s.jsonResponse(w, http.StatusCreated, task)
+		w.Header().Set("Location", s.link("/tasks/"+task.ID))
+		w.Header().Set("ETag", etag(task))
+		s.taskResponse(w, r, http.StatusCreated, task, nil, s.taskWarnings(task))
+	}
+}
+
+// listTasks lists the tasks selected by the request's filter and time range
+// query parameters. On failure it writes the error response and reports
+// false.
+func (s *server) listTasks(w http.ResponseWriter, r *http.Request) ([]*tasks.Task, bool) {
+	filter, err := taskFilter(r)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return nil, false
+	}
 
-	default:
-		s.jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	timeRange, err := taskTimeRange(r)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return nil, false
+	}
+
+	sort := r.URL.Query().Get("sort")
+	if sort != "" && sort != "created" && sort != "order" {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonError(w, http.StatusBadRequest, codeBadRequest, "Invalid value for sort: "+sort+"; must be created or order")
+		return nil, false
+	}
+
+	list, err := s.taskManager.ListInRange(r.Context(), filter, timeRange)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return nil, false
+	}
+	if sort == "order" {
+		slices.SortStableFunc(list, tasks.CompareOrder)
 	}
+
+	return list, true
 }
 
-func (s *server) handleTaskByID(w http.ResponseWriter, r *http.Request) {
-	// Extract ID from path
-	id := strings.TrimPrefix(r.URL.Path, "/tasks/")
-	if id == "" {
-		s.jsonError(w, http.StatusBadRequest, "Task ID is required")
+// handleTaskStream exports tasks as newline-delimited JSON, one task per
+// line, accepting the same filters as GET /tasks
+func (s *server) handleTaskStream(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, readMethods) {
 		return
 	}
 
-	switch r.Method {
-	case http.MethodGet:
-		task, err := s.taskManager.Get(id)
-		if err != nil {
-			s.metrics.IncrementErrors()
-			s.jsonError(w, http.StatusNotFound, err.Error())
+	fields, ok := s.fieldSelection(w, r)
+	if !ok {
+		return
+	}
+	list, ok := s.listTasks(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	// Always compact: NDJSON needs each task on a single line
+	enc := json.NewEncoder(w)
+
+	for i, task := range list {
+		if err := enc.Encode(project(task, fields)); err != nil {
+			s.logger.Warn("Task stream aborted", "written", i, "error", err)
 			return
 		}
-		s.jsonResponse(w, http.StatusOK, task)
+		if flusher != nil && (i+1)%streamFlushInterval == 0 {
+			flusher.Flush()
+		}
+	}
+}
 
-	case http.MethodPut:
-		var req struct {
-			Title       string `json:"title"`
-			Description string `json:"description"`
-			Status      string `json:"status"`
+// taskFilter builds a task filter from the request's query parameters
+func taskFilter(r *http.Request) (tasks.Filter, error) {
+	q := r.URL.Query()
+	filter := tasks.Filter{
+		Status: q.Get("status"),
+	}
+
+	if v := q.Get("archived"); v != "" {
+		archived, err := strconv.ParseBool(v)
+		if err != nil {
+			return tasks.Filter{}, fmt.Errorf("Invalid value for archived: %s", v)
+		}
+		filter.IncludeArchived = archived
+	}
+
+	if v := q.Get("starred"); v != "" {
+		starred, err := strconv.ParseBool(v)
+		if err != nil {
+			return tasks.Filter{}, fmt.Errorf("Invalid value for starred: %s", v)
 		}
+		filter.Starred = &starred
+	}
 
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			s.metrics.IncrementErrors()
-			s.jsonError(w, http.StatusBadRequest, "Invalid request body")
-			return
+	// label=team=payments matches a label value, label=team any task with
+	// the label
+	switch labels := q["label"]; len(labels) {
+	case 0:
+	case 1:
+		filter.LabelKey, filter.LabelValue, _ = strings.Cut(labels[0], "=")
+		if filter.LabelKey == "" {
+			return tasks.Filter{}, fmt.Errorf("Invalid value for label: %s", labels[0])
 		}
+	default:
+		return tasks.Filter{}, errors.New("Only one label filter is allowed")
+	}
+
+	return filter, nil
+}
+
+// taskTimeRange builds a time range from the request's RFC 3339 query
+// parameters
+func taskTimeRange(r *http.Request) (tasks.TimeRange, error) {
+	q := r.URL.Query()
+	var tr tasks.TimeRange
+
+	params := []struct {
+		name   string
+		target *time.Time
+	}{
+		{"created_after", &tr.CreatedAfter},
+		{"created_before", &tr.CreatedBefore},
+		{"updated_after", &tr.UpdatedAfter},
+		{"updated_before", &tr.UpdatedBefore},
+	}
 
-		task, err := s.taskManager.Update(id, req.Title, req.Description, req.Status)
+	for _, p := range params {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
 		if err != nil {
-			s.metrics.IncrementErrors()
-			s.jsonError(w, http.StatusNotFound, err.Error())
-			return
+			return tasks.TimeRange{}, fmt.Errorf("Invalid RFC 3339 timestamp for %s: %s", p.name, v)
 		}
+		*p.target = t.UTC()
+	}
+
+	return tr, nil
+}
 
-		s.jsonResponse(w, http.StatusOK, task)
+func (s *server) handleTaskCount(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, readMethods) {
+		return
+	}
 
-	case http.MethodDelete:
-		if err := s.taskManager.Delete(id); err != nil {
-			s.metrics.IncrementErrors()
-			s.jsonError(w, http.StatusNotFound, err.Error())
+	filter, err := taskFilter(r)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	count, err := s.taskManager.Count(r.Context(), filter)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]int{"count": count})
+}
+
+// defaultAutocompleteLimit is the number of suggestions when no limit is
+// given
+const defaultAutocompleteLimit = 10
+
+// handleAutocomplete suggests task titles for ?q, such as the text typed
+// into a search box so far
+func (s *server) handleAutocomplete(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, readMethods) {
+		return
+	}
+
+	limit := defaultAutocompleteLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+			s.jsonError(w, http.StatusBadRequest, codeBadRequest, "Invalid value for limit: "+v)
 			return
 		}
+		limit = n
+	}
 
-		s.jsonResponse(w, http.StatusOK, map[string]string{"message": "Task deleted"})
+	titles, err := s.taskManager.Autocomplete(r.Context(), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
 
-	default:
-		s.jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	s.jsonResponse(w, http.StatusOK, map[string][]string{"suggestions": titles})
+}
+
+// handleFacets counts the unarchived tasks by each distinct status, assignee
+// and label, such as for the options of filter dropdowns
+func (s *server) handleFacets(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, readMethods) {
+		return
+	}
+
+	facets, err := s.taskManager.Facets(r.Context())
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
 	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{"facets": facets})
 }
 
-func (s *server) jsonResponse(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+// handleMissingTaskID answers /tasks/, a task route without an ID
+func (s *server) handleMissingTaskID(w http.ResponseWriter, r *http.Request) {
+	s.jsonError(w, http.StatusBadRequest, codeBadRequest, "Task ID is required")
 }
 
-func (s *server) jsonError(w http.ResponseWriter, status int, message string) {
-	s.jsonResponse(w, status, map[string]string{"error": message})
+// pathTaskID returns the {id} path segment of a task route. The mux has
+// already unescaped it, so an encoded slash ends up in the ID and is
+// rejected along with any other malformed ID. On a malformed ID it writes a
+// 400 response and reports false.
+func (s *server) pathTaskID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if err := tasks.ValidateID(id); err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.taskError(w, err)
+		return "", false
+	}
+	return id, true
+}
+
+func (s *server) handleTaskByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.pathTaskID(w, r)
+	if !ok {
+		return
+	}
+
+	if s.handleMethods(w, r, taskByIDMethods) {
+		return
+	}
+
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		fields, ok := s.fieldSelection(w, r)
+		if !ok {
+			return
+		}
+
+		task, err := s.taskManager.Get(r.Context(), id)
+		if err != nil {
+			s.metrics.IncrementErrorsByType(errorType(err))
+			s.taskError(w, err)
+			return
+		}
+
+		w.Header().Set("ETag", etag(task))
+		w.Header().Set("Last-Modified", task.UpdatedAt.UTC().Format(http.TimeFormat))
+		if notModifiedSince(r, task.UpdatedAt) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		s.taskResponse(w, r, http.StatusOK, task, fields, nil)
+
+	case http.MethodPut:
+		var req struct {
+			Title           string            `json:"title"`
+			Description     string            `json:"description"`
+			Status          string            `json:"status"`
+			Labels          map[string]string `json:"labels"`
+			EstimateMinutes *int              `json:"estimate_minutes"`
+			SpentMinutes    *int              `json:"spent_minutes"`
+		}
+
+		if err := s.decodeJSON(w, r, &req); err != nil {
+			s.countError(dryRun, metrics.ErrorValidation)
+			s.decodeErrorResponse(w, err)
+			return
+		}
+
+		task, err := s.taskManager.Update(r.Context(), id, req.Title, req.Description, req.Status, req.Labels, req.EstimateMinutes, req.SpentMinutes, dryRun)
+		if err != nil {
+			s.countError(dryRun, errorType(err))
+			s.taskError(w, err)
+			return
+		}
+
+		if !dryRun {
+			w.Header().Set("ETag", etag(task))
+		}
+		s.dryRunResponse(w, dryRun, withWarnings(task, s.taskWarnings(task)))
+
+	case http.MethodPatch:
+		var patch json.RawMessage
+		if err := s.decodeJSON(w, r, &patch); err != nil {
+			s.countError(dryRun, metrics.ErrorValidation)
+			s.decodeErrorResponse(w, err)
+			return
+		}
+
+		task, err := s.taskManager.Patch(r.Context(), id, patch, dryRun)
+		if err != nil {
+			s.countError(dryRun, errorType(err))
+			s.taskError(w, err)
+			return
+		}
+
+		if !dryRun {
+			w.Header().Set("ETag", etag(task))
+		}
+		s.dryRunResponse(w, dryRun, withWarnings(task, s.taskWarnings(task)))
+
+	case http.MethodDelete:
+		if err := s.taskManager.Delete(r.Context(), id, ifMatch(r), dryRun); err != nil {
+			s.countError(dryRun, errorType(err))
+			s.taskError(w, err)
+			return
+		}
+
+		if dryRun {
+			s.dryRunResponse(w, dryRun, map[string]string{"message": "Task would be deleted"})
+			return
+		}
+		s.jsonResponse(w, http.StatusOK, map[string]string{"message": "Task deleted"})
+	}
+}
+
+// notModifiedSince reports whether the request's If-Modified-Since header is
+// at or after modified. HTTP dates have second precision, so modified is
+// truncated to the second before comparing. Unparseable dates are ignored.
+func notModifiedSince(r *http.Request, modified time.Time) bool {
+	v := r.Header.Get("If-Modified-Since")
+	if v == "" {
+		return false
+	}
+
+	since, err := http.ParseTime(v)
+	if err != nil {
+		return false
+	}
+
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// isDryRun reports whether the request asks for a dry run, either with the
+// dry_run query parameter or the Dry-Run header
+func isDryRun(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		v = r.Header.Get("Dry-Run")
+	}
+	if v == "" {
+		return false, nil
+	}
+
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("Invalid value for dry_run: %s", v)
+	}
+	return dryRun, nil
+}
+
+// countError records a failed request unless it was a dry run, which must
+// leave the metrics untouched
+func (s *server) countError(dryRun bool, kind string) {
+	if !dryRun {
+		s.metrics.IncrementErrorsByType(kind)
+	}
+}
+
+// dryRunResponse writes the result of a mutating request, marking dry runs
+// with a Dry-Run response header
+func (s *server) dryRunResponse(w http.ResponseWriter, dryRun bool, data interface{}) {
+	if dryRun {
+		w.Header().Set("Dry-Run", "true")
+	}
+	s.jsonResponse(w, http.StatusOK, data)
+}
+
+// handleTaskAction serves the action sub-resources of a task, such as
+// POST /tasks/{id}/archive
+func (s *server) handleTaskAction(w http.ResponseWriter, r *http.Request) {
+	var run func(ctx context.Context, id string) (*tasks.Task, error)
+	allowed := actionMethods
+	switch r.PathValue("action") {
+	case "archive":
+		run = s.taskManager.Archive
+	case "unarchive":
+		run = s.taskManager.Unarchive
+	case "star":
+		// POST stars the task and DELETE removes the star
+		allowed = starMethods
+		run = s.taskManager.Star
+		if r.Method == http.MethodDelete {
+			run = s.taskManager.Unstar
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	id, ok := s.pathTaskID(w, r)
+	if !ok {
+		return
+	}
+	if s.handleMethods(w, r, allowed) {
+		return
+	}
+
+	task, err := run(r.Context(), id)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, task)
+}
+
+// handleDuplicate creates a copy of a task, answering like a create
+func (s *server) handleDuplicate(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.pathTaskID(w, r)
+	if !ok {
+		return
+	}
+	if s.handleMethods(w, r, actionMethods) {
+		return
+	}
+
+	task, err := s.taskManager.Duplicate(r.Context(), id)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", s.link("/tasks/"+task.ID))
+	w.Header().Set("ETag", etag(task))
+	s.taskResponse(w, r, http.StatusCreated, task, nil, s.taskWarnings(task))
+}
+
+// handleWatcher adds a watcher to a task with PUT and removes it with
+// DELETE. Both are idempotent.
+func (s *server) handleWatcher(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.pathTaskID(w, r)
+	if !ok {
+		return
+	}
+	if s.handleMethods(w, r, watcherMethods) {
+		return
+	}
+
+	run := s.taskManager.Watch
+	if r.Method == http.MethodDelete {
+		run = s.taskManager.Unwatch
+	}
+	task, err := run(r.Context(), id, r.PathValue("watcher"))
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, task)
+}
+
+// handleClaim claims a task for the worker in the body with POST, or
+// releases the claim of the worker given by ?worker= with DELETE. A task
+// claimed by another worker gets a 409.
+func (s *server) handleClaim(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.pathTaskID(w, r)
+	if !ok {
+		return
+	}
+	if s.handleMethods(w, r, claimMethods) {
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := s.taskManager.Release(r.Context(), id, r.URL.Query().Get("worker")); err != nil {
+			s.metrics.IncrementErrorsByType(errorType(err))
+			s.taskError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req struct {
+		Worker string `json:"worker"`
+		TTL    string `json:"ttl"`
+	}
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.decodeErrorResponse(w, err)
+		return
+	}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonErrorDetails(w, http.StatusBadRequest, codeInvalidBody, "Invalid value for ttl: "+req.TTL+"; must be a duration such as 30s", map[string]string{"field": "ttl"})
+		return
+	}
+
+	claimed, err := s.taskManager.Claim(r.Context(), id, req.Worker, ttl)
+	if err == nil && !claimed {
+		err = tasks.ErrClaimHeld
+	}
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	task, err := s.taskManager.Get(r.Context(), id)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+	s.jsonResponse(w, http.StatusOK, task)
+}
+
+// handleMove moves a task to directly after the task given in the body,
+// or to the top of its status if none is given
+func (s *server) handleMove(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.pathTaskID(w, r)
+	if !ok {
+		return
+	}
+	if s.handleMethods(w, r, actionMethods) {
+		return
+	}
+
+	var req struct {
+		After string `json:"after"`
+	}
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.decodeErrorResponse(w, err)
+		return
+	}
+
+	task, err := s.taskManager.Reorder(r.Context(), id, req.After)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, task)
+}
+
+// handleSetOrders sets the order of every listed task, for saving a whole
+// reordered board. Either all tasks are changed or, if any does not exist,
+// none is.
+func (s *server) handleSetOrders(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, orderMethods) {
+		return
+	}
+
+	var req []struct {
+		ID    string   `json:"id"`
+		Order *float64 `json:"order"`
+	}
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.decodeErrorResponse(w, err)
+		return
+	}
+
+	orders := make(map[string]float64, len(req))
+	for _, item := range req {
+		msg := ""
+		switch _, dup := orders[item.ID]; {
+		case item.Order == nil:
+			msg = "Every item needs an order: " + item.ID
+		case dup:
+			msg = "Task listed more than once: " + item.ID
+		default:
+			orders[item.ID] = *item.Order
+			continue
+		}
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonError(w, http.StatusBadRequest, codeBadRequest, msg)
+		return
+	}
+
+	updated, err := s.taskManager.SetOrders(r.Context(), orders)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, updated)
+}
+
+// handleDrain reports the drain state or starts draining. Draining cannot
+// be undone, so repeated POSTs have no further effect.
+func (s *server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, adminMethods) {
+		return
+	}
+
+	if r.Method == http.MethodPost && !s.draining.Swap(true) {
+		s.logger.Warn("Draining; new requests will be rejected", "in_flight", s.inFlight.Load())
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"draining":  s.draining.Load(),
+		"in_flight": s.inFlight.Load(),
+	})
+}
+
+// handleMaintenance reports or changes the maintenance mode state
+func (s *server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, adminMethods) {
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			Enabled *bool `json:"enabled"`
+		}
+
+		if err := s.decodeJSON(w, r, &req); err != nil {
+			s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+			s.decodeErrorResponse(w, err)
+			return
+		}
+		if req.Enabled == nil {
+			s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+			s.jsonErrorDetails(w, http.StatusBadRequest, codeInvalidBody, "Missing field: enabled", map[string]string{"field": "enabled"})
+			return
+		}
+
+		if s.maintenance.Swap(*req.Enabled) != *req.Enabled {
+			s.logger.Warn("Maintenance mode changed", "enabled", *req.Enabled)
+		}
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]bool{"maintenance": s.maintenance.Load()})
+}
+
+// handleMetricsPause reports whether metrics collection is paused and, for
+// POST, pauses or resumes it
+func (s *server) handleMetricsPause(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, adminMethods) {
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			Paused *bool `json:"paused"`
+		}
+
+		if err := s.decodeJSON(w, r, &req); err != nil {
+			s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+			s.decodeErrorResponse(w, err)
+			return
+		}
+		if req.Paused == nil {
+			s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+			s.jsonErrorDetails(w, http.StatusBadRequest, codeInvalidBody, "Missing field: paused", map[string]string{"field": "paused"})
+			return
+		}
+
+		if *req.Paused {
+			s.metrics.Pause()
+		} else {
+			s.metrics.Resume()
+		}
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]bool{"paused": s.metrics.Paused()})
+}
+
+// handleLogLevel reports the minimum level of logged messages and, for
+// PUT, changes it without a restart
+func (s *server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, settingMethods) {
+		return
+	}
+
+	if r.Method != http.MethodPut {
+		s.jsonResponse(w, http.StatusOK, map[string]string{"level": levelName(s.logLevel.Level())})
+		return
+	}
+
+	var req struct {
+		Level *string `json:"level"`
+	}
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.decodeErrorResponse(w, err)
+		return
+	}
+	if req.Level == nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonErrorDetails(w, http.StatusBadRequest, codeInvalidBody, "Missing field: level", map[string]string{"field": "level"})
+		return
+	}
+	level, err := logger.ParseLevel(*req.Level)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonErrorDetails(w, http.StatusBadRequest, codeBadRequest, "Invalid log level: "+*req.Level+"; expected debug, info, warn or error", map[string]string{"field": "level"})
+		return
+	}
+
+	previous := s.logLevel.Level()
+	s.logLevel.Set(level)
+	// Logged at warn so the change is recorded whatever the new level
+	s.logger.Warn("Log level changed", "previous", previous, "level", level)
+
+	s.jsonResponse(w, http.StatusOK, map[string]string{
+		"previous": levelName(previous),
+		"level":    levelName(level),
+	})
+}
+
+// levelName returns the lowercase name of a log level, as accepted by
+// --log-level
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// handleRequestLog lists the most recent requests, newest first
+func (s *server) handleRequestLog(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, readMethods) {
+		return
+	}
+
+	var entries []requestLogEntry
+	if s.requestLog != nil {
+		entries = s.requestLog.recent()
+	}
+
+	s.jsonResponse(w, http.StatusOK, entries)
+}
+
+// handleDeadLetters lists the webhook deliveries that were given up on,
+// along with the number still being attempted
+func (s *server) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, readMethods) {
+		return
+	}
+
+	deadLetters := s.webhooks.DeadLetters()
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"dead_letters": deadLetters,
+		"count":        len(deadLetters),
+		"in_flight":    s.webhooks.InFlight(),
+	})
+}
+
+// handleFlush deletes every task, if allowed by the configuration
+func (s *server) handleFlush(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, flushMethods) {
+		return
+	}
+
+	if !s.cfg.AllowFlush {
+		s.metrics.IncrementErrorsByType(metrics.ErrorForbidden)
+		s.logger.Warn("Refused to delete all tasks, flushing is not allowed", "remote_addr", r.RemoteAddr)
+		s.jsonError(w, http.StatusForbidden, codeFlushDisabled, "Deleting all tasks is disabled; start the server with --allow-flush")
+		return
+	}
+
+	s.logger.Warn("Deleting all tasks", "remote_addr", r.RemoteAddr)
+	deleted, err := s.taskManager.Clear(r.Context())
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]int{"deleted": deleted})
+}
+
+// createRequest is the body of a request to create a task
+type createRequest struct {
+	Title           string            `json:"title"`
+	Description     string            `json:"description"`
+	Assignee        string            `json:"assignee"`
+	Status          string            `json:"status"`
+	Labels          map[string]string `json:"labels"`
+	EstimateMinutes int               `json:"estimate_minutes"`
+	SpentMinutes    int               `json:"spent_minutes"`
+	DueAt           *time.Time        `json:"due_at"`
+}
+
+func (req createRequest) params() tasks.CreateParams {
+	return tasks.CreateParams{
+		Title:       req.Title,
+		Description: req.Description,
+		Assignee:    req.Assignee,
+		Status:      req.Status,
+		Labels:      req.Labels,
+
+		EstimateMinutes: req.EstimateMinutes,
+		SpentMinutes:    req.SpentMinutes,
+		DueAt:           req.DueAt,
+	}
+}
+
+// validateResult is the outcome for one task of a batch validation
+type validateResult struct {
+	Index    int             `json:"index"`
+	Valid    bool            `json:"valid"`
+	Warnings []tasks.Warning `json:"warnings,omitempty"`
+	Error    *errorBody      `json:"error,omitempty"`
+}
+
+// handleValidate checks an array of create requests without creating any
+// tasks, reporting per item whether it would be accepted. Invalid items are
+// the expected outcome here, so they are not counted as errors.
+func (s *server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, actionMethods) {
+		return
+	}
+
+	var req []createRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.decodeErrorResponse(w, err)
+		return
+	}
+
+	params := make([]tasks.CreateParams, len(req))
+	for i, item := range req {
+		params[i] = item.params()
+	}
+	results, err := s.taskManager.ValidateBatch(r.Context(), params)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	response := make([]validateResult, len(results))
+	invalid := 0
+	for i, res := range results {
+		response[i] = validateResult{Index: i, Valid: res.Err == nil, Warnings: res.Warnings}
+		if res.Err != nil {
+			_, body := s.taskErrorBody(res.Err)
+			response[i].Error = &body
+			invalid++
+		}
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"valid":   len(results) - invalid,
+		"invalid": invalid,
+		"results": response,
+	})
+}
+
+// bulkStatusResult is the outcome for one task of a bulk status update
+type bulkStatusResult struct {
+	ID    string      `json:"id"`
+	Task  *tasks.Task `json:"task,omitempty"`
+	Error *errorBody  `json:"error,omitempty"`
+}
+
+// upsertRequest is an item of an upsert, a task to create or, with an ID,
+// to update
+type upsertRequest struct {
+	ID string `json:"id"`
+	createRequest
+}
+
+// upsertResult is the outcome for one item of an upsert
+type upsertResult struct {
+	Index   int         `json:"index"`
+	ID      string      `json:"id,omitempty"`
+	Created bool        `json:"created"`
+	Task    *tasks.Task `json:"task,omitempty"`
+	Error   *errorBody  `json:"error,omitempty"`
+}
+
+// handleUpsert creates the given tasks that have no ID and updates those
+// that have one. Each item succeeds or fails on its own; the response lists
+// the outcome per item, in request order.
+func (s *server) handleUpsert(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, actionMethods) {
+		return
+	}
+
+	var req []upsertRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.decodeErrorResponse(w, err)
+		return
+	}
+
+	items := make([]*tasks.Task, len(req))
+	for i, item := range req {
+		items[i] = &tasks.Task{
+			ID:          item.ID,
+			Title:       item.Title,
+			Description: item.Description,
+			Assignee:    item.Assignee,
+			Status:      item.Status,
+			Labels:      item.Labels,
+
+			EstimateMinutes: item.EstimateMinutes,
+			SpentMinutes:    item.SpentMinutes,
+			DueAt:           item.DueAt,
+		}
+	}
+	results, err := s.taskManager.Upsert(r.Context(), items)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	response := make([]upsertResult, len(results))
+	created, failed := 0, 0
+	for i, res := range results {
+		response[i] = upsertResult{Index: i, ID: res.ID, Created: res.Created, Task: res.Task}
+		switch {
+		case res.Err != nil:
+			_, body := s.taskErrorBody(res.Err)
+			response[i].Error = &body
+			failed++
+		case res.Created:
+			created++
+		}
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"created": created,
+		"updated": len(results) - created - failed,
+		"failed":  failed,
+		"results": response,
+	})
+}
+
+// handleBulkStatus sets the status of several tasks at once. Each task
+// succeeds or fails on its own; the response lists the outcome per ID.
+func (s *server) handleBulkStatus(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, actionMethods) {
+		return
+	}
+
+	var req struct {
+		IDs    []string `json:"ids"`
+		Status string   `json:"status"`
+	}
+
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.decodeErrorResponse(w, err)
+		return
+	}
+
+	results, err := s.taskManager.UpdateStatusBatch(r.Context(), req.IDs, req.Status)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	response := make([]bulkStatusResult, len(results))
+	failed := 0
+	for i, res := range results {
+		response[i] = bulkStatusResult{ID: res.ID, Task: res.Task}
+		if res.Err != nil {
+			_, body := s.taskErrorBody(res.Err)
+			response[i].Error = &body
+			failed++
+		}
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"updated": len(results) - failed,
+		"failed":  failed,
+		"results": response,
+	})
+}
+
+// streamFlushInterval is the number of tasks written between flushes when
+// streaming a task list
+const streamFlushInterval = 100
+
+// streamTasks writes the tasks as a JSON array, or a JSON:API document if the
+// client asked for one, one element at a time instead of encoding the whole
+// list up front. Once the first byte is written the
+// status can no longer change, so a failure part way through is logged and
+// the response is cut short.
+func (s *server) streamTasks(w http.ResponseWriter, r *http.Request, list []*tasks.Task, fields []string) {
+	contentType, start, end := "application/json", "[", "]\n"
+	element := func(task *tasks.Task) interface{} { return project(task, fields) }
+	if wantsJSONAPI(r) {
+		contentType, start, end = jsonAPIMediaType, `{"data":[`, "]}\n"
+		element = func(task *tasks.Task) interface{} { return taskResource(task, fields) }
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	enc := newEncoder(w)
+
+	if _, err := io.WriteString(w, start); err != nil {
+		s.logger.Warn("Task list stream aborted", "error", err)
+		return
+	}
+
+	for i, task := range list {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				s.logger.Warn("Task list stream aborted", "written", i, "error", err)
+				return
+			}
+		}
+		if err := enc.Encode(element(task)); err != nil {
+			s.logger.Warn("Task list stream aborted", "written", i, "error", err)
+			return
+		}
+		if flusher != nil && (i+1)%streamFlushInterval == 0 {
+			flusher.Flush()
+		}
+	}
+
+	if _, err := io.WriteString(w, end); err != nil {
+		s.logger.Warn("Task list stream aborted", "written", len(list), "error", err)
+	}
+}
+
+// jsonResponse writes data as JSON with the given status. Any additional
+// headers must be set on w before calling it.
+func (s *server) jsonResponse(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	newEncoder(w).Encode(nonNull(data))
+}
+
+// nonNull replaces a nil slice or map with an empty one, so that lists
+// encode as [] and objects as {} rather than null, which strict clients
+// reject. The values of a map[string]interface{}, the shape most responses
+// are built in, are replaced too. Struct fields are not looked into; those
+// that must never be null are initialized where they are set.
+func nonNull(data interface{}) interface{} {
+	if m, ok := data.(map[string]interface{}); ok && m != nil {
+		for k, v := range m {
+			m[k] = nonNull(v)
+		}
+		return m
+	}
+
+	v := reflect.ValueOf(data)
+	switch {
+	case v.Kind() == reflect.Slice && v.IsNil():
+		return reflect.MakeSlice(v.Type(), 0, 0).Interface()
+	case v.Kind() == reflect.Map && v.IsNil():
+		return reflect.MakeMap(v.Type()).Interface()
+	}
+	return data
+}
+
+// newEncoder returns a JSON encoder for w, indenting the output when the
+// response was asked to be pretty-printed
+func newEncoder(w http.ResponseWriter) *json.Encoder {
+	enc := json.NewEncoder(w)
+	if pw, ok := w.(*prettyWriter); ok && pw.pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc
 }
@@ -0,0 +1,764 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/api"
+	"github.com/bhargavparmar/hive-demo/pkg/api/apitest"
+	"github.com/bhargavparmar/hive-demo/pkg/clock"
+	"github.com/bhargavparmar/hive-demo/pkg/database"
+	"github.com/bhargavparmar/hive-demo/pkg/idgen"
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+	"github.com/bhargavparmar/hive-demo/pkg/storage"
+	"github.com/bhargavparmar/hive-demo/pkg/tasks"
+	"github.com/bhargavparmar/hive-demo/pkg/tracing"
+	"github.com/bhargavparmar/hive-demo/pkg/webhooks"
+	"github.com/bhargavparmar/hive-demo/pkg/workers"
+	"github.com/cilium/hive"
+	"github.com/cilium/hive/cell"
+)
+
+// do sends a request to the test server and returns the response with its
+// body read. headers are name and value pairs.
+func do(tb testing.TB, srv *apitest.Server, method, path, body string, headers ...string) (*http.Response, string) {
+	tb.Helper()
+	return send(tb, srv.Client(), method, srv.URL+path, body, headers...)
+}
+
+// send is do for any client and URL
+func send(tb testing.TB, client *http.Client, method, url, body string, headers ...string) (*http.Response, string) {
+	tb.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return resp, string(data)
+}
+
+// expectStatus fails the test unless resp has the wanted status
+func expectStatus(tb testing.TB, resp *http.Response, body string, want int) {
+	tb.Helper()
+	if resp.StatusCode != want {
+		tb.Fatalf("%s %s: got status %d, want %d; body: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, want, body)
+	}
+}
+
+// createTask creates a task directly through the task manager
+func createTask(tb testing.TB, srv *apitest.Server, title string) *tasks.Task {
+	tb.Helper()
+	task, err := srv.Tasks.Create(context.Background(), tasks.CreateParams{Title: title})
+	if err != nil {
+		tb.Fatalf("creating %q: %v", title, err)
+	}
+	return task
+}
+
+func TestCreateSetsLocation(t *testing.T) {
+	srv := apitest.New(t)
+
+	resp, body := do(t, srv, http.MethodPost, "/tasks", `{"title":"Write tests"}`)
+	expectStatus(t, resp, body, http.StatusCreated)
+
+	list, err := srv.Tasks.List(context.Background(), tasks.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("got %d tasks, want 1", len(list))
+	}
+	if got, want := resp.Header.Get("Location"), "/tasks/"+list[0].ID; got != want {
+		t.Fatalf("got Location %q, want %q", got, want)
+	}
+
+	// The Location must lead to the created task
+	resp, body = do(t, srv, http.MethodGet, resp.Header.Get("Location"), "")
+	expectStatus(t, resp, body, http.StatusOK)
+}
+
+func TestCreateFailureHasNoLocation(t *testing.T) {
+	srv := apitest.New(t)
+
+	resp, body := do(t, srv, http.MethodPost, "/tasks", `{"title":""}`)
+	if resp.StatusCode < 400 {
+		t.Fatalf("got status %d for an empty title; body: %s", resp.StatusCode, body)
+	}
+	if loc := resp.Header.Get("Location"); loc != "" {
+		t.Fatalf("got Location %q on a failed create", loc)
+	}
+}
+
+func TestOversizedBodyRejected(t *testing.T) {
+	srv := apitest.New(t, func(h *hive.Hive) {
+		hive.AddConfigOverride(h, func(cfg *api.Config) { cfg.MaxBodyBytes = 64 })
+	})
+	big := `{"title":"` + strings.Repeat("x", 100) + `"}`
+
+	// Declared length over the limit
+	resp, body := do(t, srv, http.MethodPost, "/tasks", big)
+	expectStatus(t, resp, body, http.StatusRequestEntityTooLarge)
+	if !strings.Contains(body, `"request_too_large"`) {
+		t.Fatalf("got body %s, want code request_too_large", body)
+	}
+
+	// Unknown length, so the limit is hit while decoding
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/tasks", io.MultiReader(strings.NewReader(big)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	chunked, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunked.Body.Close()
+	if chunked.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("chunked body: got status %d, want %d", chunked.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+
+	// A body within the limit still works
+	resp, body = do(t, srv, http.MethodPost, "/tasks", `{"title":"small"}`)
+	expectStatus(t, resp, body, http.StatusCreated)
+}
+
+func TestGetTaskIfModifiedSince(t *testing.T) {
+	srv := apitest.New(t)
+	// Not on a whole second, as HTTP dates are
+	srv.Clock.Advance(1500 * time.Millisecond)
+	task := createTask(t, srv, "cache me")
+	path := "/tasks/" + task.ID
+
+	resp, body := do(t, srv, http.MethodGet, path, "")
+	expectStatus(t, resp, body, http.StatusOK)
+	lastModified := resp.Header.Get("Last-Modified")
+	if want := task.UpdatedAt.UTC().Format(http.TimeFormat); lastModified != want {
+		t.Fatalf("got Last-Modified %q, want %q", lastModified, want)
+	}
+
+	t.Run("not modified", func(t *testing.T) {
+		resp, body := do(t, srv, http.MethodGet, path, "", "If-Modified-Since", lastModified)
+		expectStatus(t, resp, body, http.StatusNotModified)
+		if body != "" {
+			t.Fatalf("got body %q on 304", body)
+		}
+	})
+
+	t.Run("modified since", func(t *testing.T) {
+		earlier := task.UpdatedAt.Add(-time.Second).UTC().Format(http.TimeFormat)
+		resp, body := do(t, srv, http.MethodGet, path, "", "If-Modified-Since", earlier)
+		expectStatus(t, resp, body, http.StatusOK)
+		if !strings.Contains(body, task.ID) {
+			t.Fatalf("got body %s, want the task", body)
+		}
+	})
+
+	t.Run("changed after the date", func(t *testing.T) {
+		srv.Clock.Advance(2 * time.Second)
+		if _, err := srv.Tasks.Patch(context.Background(), task.ID, []byte(`{"title":"changed"}`), false); err != nil {
+			t.Fatal(err)
+		}
+		resp, body := do(t, srv, http.MethodGet, path, "", "If-Modified-Since", lastModified)
+		expectStatus(t, resp, body, http.StatusOK)
+		if resp.Header.Get("Last-Modified") == lastModified {
+			t.Fatal("Last-Modified did not change with the task")
+		}
+	})
+
+	t.Run("invalid date ignored", func(t *testing.T) {
+		resp, body := do(t, srv, http.MethodGet, path, "", "If-Modified-Since", "yesterday")
+		expectStatus(t, resp, body, http.StatusOK)
+	})
+}
+
+func TestDeleteIfMatch(t *testing.T) {
+	srv := apitest.New(t)
+
+	t.Run("stale tag", func(t *testing.T) {
+		task := createTask(t, srv, "delete me")
+		resp, body := do(t, srv, http.MethodGet, "/tasks/"+task.ID, "")
+		expectStatus(t, resp, body, http.StatusOK)
+		stale := resp.Header.Get("ETag")
+
+		srv.Clock.Advance(time.Second)
+		if _, err := srv.Tasks.Patch(context.Background(), task.ID, []byte(`{"title":"changed"}`), false); err != nil {
+			t.Fatal(err)
+		}
+
+		resp, body = do(t, srv, http.MethodDelete, "/tasks/"+task.ID, "", "If-Match", stale)
+		expectStatus(t, resp, body, http.StatusPreconditionFailed)
+		if !strings.Contains(body, `"precondition_failed"`) {
+			t.Fatalf("got body %s, want code precondition_failed", body)
+		}
+		if _, err := srv.Tasks.Get(context.Background(), task.ID); err != nil {
+			t.Fatalf("task was deleted despite the failed precondition: %v", err)
+		}
+	})
+
+	t.Run("weak tag", func(t *testing.T) {
+		task := createTask(t, srv, "weakly tagged")
+		resp, body := do(t, srv, http.MethodGet, "/tasks/"+task.ID, "")
+		expectStatus(t, resp, body, http.StatusOK)
+
+		// If-Match uses strong comparison, so a weak tag never matches
+		resp, body = do(t, srv, http.MethodDelete, "/tasks/"+task.ID, "", "If-Match", "W/"+resp.Header.Get("ETag"))
+		expectStatus(t, resp, body, http.StatusPreconditionFailed)
+	})
+
+	t.Run("current tag", func(t *testing.T) {
+		task := createTask(t, srv, "current")
+		resp, body := do(t, srv, http.MethodGet, "/tasks/"+task.ID, "")
+		expectStatus(t, resp, body, http.StatusOK)
+
+		resp, body = do(t, srv, http.MethodDelete, "/tasks/"+task.ID, "", "If-Match", `"other", `+resp.Header.Get("ETag"))
+		expectStatus(t, resp, body, http.StatusOK)
+	})
+
+	t.Run("no header", func(t *testing.T) {
+		task := createTask(t, srv, "unconditional")
+		resp, body := do(t, srv, http.MethodDelete, "/tasks/"+task.ID, "")
+		expectStatus(t, resp, body, http.StatusOK)
+	})
+}
+
+func TestMalformedTaskIDs(t *testing.T) {
+	srv := apitest.New(t)
+
+	for _, path := range []string{
+		"/tasks/..%2fetc",
+		"/tasks/..%2F..%2Fetc%2Fpasswd",
+		"/tasks/%2e%2e",
+		"/tasks/%00",
+		"/tasks/a%20b",
+		"/tasks/t%C3%A2sk",
+		"/tasks/a.b",
+		"/tasks/" + strings.Repeat("a", tasks.MaxIDLength+1),
+	} {
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			resp, body := do(t, srv, method, path, "")
+			expectStatus(t, resp, body, http.StatusBadRequest)
+			if !strings.Contains(body, "invalid task ID") {
+				t.Errorf("%s %s: got body %s, want an invalid task ID error", method, path, body)
+			}
+		}
+	}
+}
+
+func TestEmptyResultsAreNotNull(t *testing.T) {
+	srv := apitest.New(t)
+
+	for _, tc := range []struct {
+		method, path, body string
+		headers            []string
+		want               string
+	}{
+		// Asked first, before any request has been logged
+		{method: http.MethodGet, path: "/admin/requests", want: `[]`},
+		{method: http.MethodGet, path: "/tasks", want: `[]`},
+		{method: http.MethodGet, path: "/tasks?status=completed", want: `[]`},
+		{method: http.MethodGet, path: "/tasks/autocomplete?q=x", want: `{"suggestions":[]}`},
+		{method: http.MethodGet, path: "/tasks/facets", want: `{"facets":{"assignee":{},"label":{},"status":{}}}`},
+		{method: http.MethodGet, path: "/admin/webhooks/dead-letter", want: `{"count":0,"dead_letters":[],"in_flight":0}`},
+		// Every row fails, so no task is created
+		{
+			method: http.MethodPost, path: "/tasks/import.csv", body: "title\n\"\"\n",
+			headers: []string{"Content-Type", "text/csv"},
+			want:    `"tasks":[]`,
+		},
+	} {
+		resp, body := do(t, srv, tc.method, tc.path, tc.body, tc.headers...)
+		expectStatus(t, resp, body, http.StatusOK)
+		if !strings.Contains(body, tc.want) {
+			t.Errorf("%s %s: got body %s, want %s", tc.method, tc.path, body, tc.want)
+		}
+		if strings.Contains(body, "null") {
+			t.Errorf("%s %s: got null in body %s", tc.method, tc.path, body)
+		}
+	}
+}
+
+func TestOverlongTitleRejected(t *testing.T) {
+	srv := apitest.New(t, func(h *hive.Hive) {
+		hive.AddConfigOverride(h, func(cfg *tasks.Config) { cfg.MaxTitleLength = 10 })
+	})
+
+	resp, body := do(t, srv, http.MethodPost, "/tasks", `{"title":"`+strings.Repeat("x", 10)+`"}`)
+	expectStatus(t, resp, body, http.StatusCreated)
+
+	resp, body = do(t, srv, http.MethodPost, "/tasks", `{"title":"`+strings.Repeat("x", 11)+`"}`)
+	expectStatus(t, resp, body, http.StatusUnprocessableEntity)
+	if !strings.Contains(body, `"field":"title"`) || !strings.Contains(body, "at most 10 characters") {
+		t.Fatalf("got body %s, want the title field and its limit", body)
+	}
+}
+
+// routeSeries returns the series of http_route_requests_total the server
+// exposes
+func routeSeries(tb testing.TB, srv *apitest.Server) []string {
+	tb.Helper()
+	resp, body := do(tb, srv, http.MethodGet, "/metrics", "")
+	expectStatus(tb, resp, body, http.StatusOK)
+
+	var series []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "http_route_requests_total{") {
+			series = append(series, line)
+		}
+	}
+	return series
+}
+
+func TestRouteMetricsUseTemplates(t *testing.T) {
+	srv := apitest.New(t)
+
+	for i := range 1000 {
+		do(t, srv, http.MethodGet, fmt.Sprintf("/tasks/missing-%d", i), "")
+	}
+
+	series := routeSeries(t, srv)
+	want := `http_route_requests_total{method="GET",route="/tasks/{id}",status="404"} 1000`
+	if !slices.Contains(series, want) {
+		t.Fatalf("got series %v, want %s", series, want)
+	}
+	for _, s := range series {
+		if strings.Contains(s, "missing-") {
+			t.Fatalf("got a series for a concrete path: %s", s)
+		}
+	}
+}
+
+func TestRouteMetricsCapped(t *testing.T) {
+	const limit = 5
+	srv := apitest.New(t, func(h *hive.Hive) {
+		hive.AddConfigOverride(h, func(cfg *metrics.Config) { cfg.MaxRouteSeries = limit })
+	})
+
+	// Every method starts a new series
+	for i := range 100 {
+		do(t, srv, fmt.Sprintf("METHOD%d", i), "/health", "")
+	}
+
+	series := routeSeries(t, srv)
+	if len(series) > limit+1 {
+		t.Fatalf("got %d series, want at most %d and the overflow series: %v", len(series), limit, series)
+	}
+	overflow := `http_route_requests_total{method="other",route="other",status="other"} `
+	if !slices.ContainsFunc(series, func(s string) bool { return strings.HasPrefix(s, overflow) }) {
+		t.Fatalf("got series %v, want an overflow series", series)
+	}
+}
+
+func TestUpsertDoesNotCreateRouteNames(t *testing.T) {
+	srv := apitest.New(t, func(h *hive.Hive) {
+		hive.AddConfigOverride(h, func(cfg *tasks.Config) { cfg.UpsertCreateMissing = true })
+	})
+
+	for _, id := range []string{"autocomplete", "bulk-status", "count", "facets", "order", "stream", "upsert", "validate"} {
+		resp, body := do(t, srv, http.MethodPost, "/tasks/upsert", `[{"id":"`+id+`","title":"shadowed"}]`)
+		expectStatus(t, resp, body, http.StatusOK)
+		if !strings.Contains(body, `"validation_failed"`) {
+			t.Errorf("upserting %q: got body %s, want code validation_failed", id, body)
+		}
+	}
+	if count, err := srv.Tasks.Count(context.Background(), tasks.Filter{}); err != nil || count != 0 {
+		t.Fatalf("got %d tasks (error %v), want none", count, err)
+	}
+
+	// Other IDs are created, and can be reached by their URL
+	resp, body := do(t, srv, http.MethodPost, "/tasks/upsert", `[{"id":"client-1","title":"mine"}]`)
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, srv, http.MethodGet, "/tasks/client-1", "")
+	expectStatus(t, resp, body, http.StatusOK)
+}
+
+func TestGzipETags(t *testing.T) {
+	srv := apitest.New(t, func(h *hive.Hive) {
+		hive.AddConfigOverride(h, func(cfg *api.Config) { cfg.GzipLevel = "default" })
+	})
+
+	// tag gets the ETag of a task as sent with the given Accept-Encoding.
+	// The client would otherwise ask for gzip itself.
+	tag := func(t *testing.T, id, encoding string) string {
+		resp, body := do(t, srv, http.MethodGet, "/tasks/"+id, "", "Accept-Encoding", encoding)
+		expectStatus(t, resp, body, http.StatusOK)
+		if got := resp.Header.Get("Content-Encoding"); (got == "gzip") != (encoding == "gzip") {
+			t.Fatalf("got Content-Encoding %q asking for %s", got, encoding)
+		}
+		return resp.Header.Get("ETag")
+	}
+
+	task := createTask(t, srv, "compressed")
+	plain, compressed := tag(t, task.ID, "identity"), tag(t, task.ID, "gzip")
+	if want := strings.TrimSuffix(plain, `"`) + `-gzip"`; compressed != want {
+		t.Fatalf("got compressed ETag %s, want %s", compressed, want)
+	}
+
+	t.Run("If-Match", func(t *testing.T) {
+		for _, from := range []string{"identity", "gzip"} {
+			for _, encoding := range []string{"identity", "gzip"} {
+				task := createTask(t, srv, "delete me")
+				resp, body := do(t, srv, http.MethodDelete, "/tasks/"+task.ID, "",
+					"If-Match", tag(t, task.ID, from), "Accept-Encoding", encoding)
+				expectStatus(t, resp, body, http.StatusOK)
+			}
+		}
+	})
+
+	t.Run("If-None-Match", func(t *testing.T) {
+		for _, from := range []string{"identity", "gzip"} {
+			resp, body := do(t, srv, http.MethodGet, "/tasks", "", "Accept-Encoding", from)
+			expectStatus(t, resp, body, http.StatusOK)
+			listTag := resp.Header.Get("ETag")
+
+			for _, encoding := range []string{"identity", "gzip"} {
+				resp, body := do(t, srv, http.MethodGet, "/tasks", "", "If-None-Match", listTag, "Accept-Encoding", encoding)
+				expectStatus(t, resp, body, http.StatusNotModified)
+			}
+		}
+	})
+}
+
+func TestDuplicateTitleConflict(t *testing.T) {
+	srv := apitest.New(t, func(h *hive.Hive) {
+		hive.AddConfigOverride(h, func(cfg *tasks.Config) { cfg.UniqueTitles = true })
+	})
+	createTask(t, srv, "Deploy")
+	other := createTask(t, srv, "Other")
+
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodPost, "/tasks", `{"title":"Deploy"}`},
+		{http.MethodPatch, "/tasks/" + other.ID, `{"title":"Deploy"}`},
+	} {
+		resp, body := do(t, srv, req.method, req.path, req.body)
+		expectStatus(t, resp, body, http.StatusConflict)
+		if !strings.Contains(body, `"duplicate_title"`) {
+			t.Errorf("%s %s: got body %s, want code duplicate_title", req.method, req.path, body)
+		}
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	const limit = 3
+	srv := apitest.New(t, func(h *hive.Hive) {
+		hive.AddConfigOverride(h, func(cfg *api.Config) { cfg.MaxConcurrent = limit })
+	})
+
+	// Each create holds its slot until its body is written
+	bodies := make([]*io.PipeWriter, limit)
+	results := make(chan int, limit)
+	for i := range bodies {
+		pr, pw := io.Pipe()
+		bodies[i] = pw
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/tasks", pr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		go func() {
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Error(err)
+				results <- 0
+				return
+			}
+			resp.Body.Close()
+			results <- resp.StatusCode
+		}()
+		if _, err := pw.Write([]byte(`{"title":`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// /stats is not limited, so it can watch the slots fill up
+	want := fmt.Sprintf(`"concurrency":{"in_flight":%d,"limit":%d}`, limit, limit)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		resp, body := do(t, srv, http.MethodGet, "/stats", "")
+		expectStatus(t, resp, body, http.StatusOK)
+		if strings.Contains(body, want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got stats %s, want %s", body, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	resp, body := do(t, srv, http.MethodGet, "/tasks", "")
+	expectStatus(t, resp, body, http.StatusServiceUnavailable)
+	if !strings.Contains(body, `"overloaded"`) {
+		t.Fatalf("got body %s, want code overloaded", body)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "1" {
+		t.Fatalf("got Retry-After %q, want 1", got)
+	}
+
+	for _, pw := range bodies {
+		pw.Write([]byte(`"held"}`))
+		pw.Close()
+	}
+	for range limit {
+		if status := <-results; status != http.StatusCreated {
+			t.Fatalf("held create: got status %d, want %d", status, http.StatusCreated)
+		}
+	}
+
+	resp, body = do(t, srv, http.MethodGet, "/tasks", "")
+	expectStatus(t, resp, body, http.StatusOK)
+}
+
+func TestFlush(t *testing.T) {
+	t.Run("refused", func(t *testing.T) {
+		srv := apitest.New(t)
+		createTask(t, srv, "kept")
+
+		resp, body := do(t, srv, http.MethodDelete, "/admin/tasks", "")
+		expectStatus(t, resp, body, http.StatusForbidden)
+		if !strings.Contains(body, `"flush_disabled"`) {
+			t.Fatalf("got body %s, want code flush_disabled", body)
+		}
+		if byType := srv.Metrics.GetErrorsByType(); byType[metrics.ErrorForbidden] != 1 {
+			t.Fatalf("got errors by type %v, want one forbidden error", byType)
+		}
+		if count, err := srv.Tasks.Count(context.Background(), tasks.Filter{}); err != nil || count != 1 {
+			t.Fatalf("got %d tasks (error %v) after a refused flush, want 1", count, err)
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		srv := apitest.New(t, func(h *hive.Hive) {
+			hive.AddConfigOverride(h, func(cfg *api.Config) { cfg.AllowFlush = true })
+		})
+		createTask(t, srv, "deleted")
+		createTask(t, srv, "deleted too")
+
+		resp, body := do(t, srv, http.MethodDelete, "/admin/tasks", "")
+		expectStatus(t, resp, body, http.StatusOK)
+		if !strings.Contains(body, `"deleted":2`) {
+			t.Fatalf("got body %s, want 2 deleted", body)
+		}
+	})
+}
+
+func TestOptionsAllow(t *testing.T) {
+	srv := apitest.New(t)
+	task := createTask(t, srv, "options")
+
+	for _, tc := range []struct{ path, allow string }{
+		{"/tasks", "GET, HEAD, POST, OPTIONS"},
+		{"/tasks/" + task.ID, "GET, HEAD, PUT, PATCH, DELETE, OPTIONS"},
+	} {
+		resp, body := do(t, srv, http.MethodOptions, tc.path, "")
+		expectStatus(t, resp, body, http.StatusNoContent)
+		if got := resp.Header.Get("Allow"); got != tc.allow {
+			t.Errorf("OPTIONS %s: got Allow %q, want %q", tc.path, got, tc.allow)
+		}
+
+		// A method that is not allowed lists the same methods
+		resp, body = do(t, srv, "TRACE", tc.path, "")
+		expectStatus(t, resp, body, http.StatusMethodNotAllowed)
+		if got := resp.Header.Get("Allow"); got != tc.allow {
+			t.Errorf("TRACE %s: got Allow %q, want %q", tc.path, got, tc.allow)
+		}
+	}
+}
+
+var discardLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// startedAPI is the application served on a local port by a started hive,
+// for tests of the start and stop hooks that apitest does not run
+type startedAPI struct {
+	hive    *hive.Hive
+	url     string
+	stopped bool
+}
+
+// startAPI starts the application with dbCell providing the database, and
+// stops it when the test ends unless the test stopped it
+func startAPI(tb testing.TB, dbCell cell.Cell) *startedAPI {
+	tb.Helper()
+
+	var srv api.Server
+	h := hive.New(
+		tracing.Cell,
+		dbCell,
+		storage.Cell,
+		metrics.Cell,
+		idgen.Cell,
+		clock.Cell,
+		cell.Provide(func() *slog.LevelVar { return new(slog.LevelVar) }),
+		workers.Cell,
+		webhooks.Cell,
+		tasks.Cell,
+		api.Cell,
+		cell.Invoke(func(s api.Server) { srv = s }),
+	)
+	hive.AddConfigOverride(h, func(cfg *api.Config) {
+		cfg.Host = "127.0.0.1"
+		cfg.Port = 0
+	})
+	hive.AddConfigOverride(h, func(cfg *storage.Config) { cfg.Backend = storage.BackendMemory })
+
+	a := &startedAPI{hive: h}
+	if err := h.Start(discardLog, context.Background()); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if a.stopped {
+			return
+		}
+		if err := a.stop(); err != nil {
+			tb.Error(err)
+		}
+	})
+	a.url = "http://" + srv.Address()[0]
+	return a
+}
+
+// do is the package's do for the started application
+func (a *startedAPI) do(tb testing.TB, method, path, body string, headers ...string) (*http.Response, string) {
+	tb.Helper()
+	return send(tb, http.DefaultClient, method, a.url+path, body, headers...)
+}
+
+// stop stops the hive
+func (a *startedAPI) stop() error {
+	a.stopped = true
+	return a.hive.Stop(discardLog, context.Background())
+}
+
+// slowDB is a database still connecting in the background, until the test
+// marks it connected
+type slowDB struct {
+	connected atomic.Bool
+}
+
+func (d *slowDB) Ping(ctx context.Context) error {
+	if !d.connected.Load() {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func (d *slowDB) IsConnected() bool { return d.connected.Load() }
+
+func TestNotReadyWhileDatabaseConnects(t *testing.T) {
+	db := &slowDB{}
+	a := startAPI(t, cell.Provide(func() database.Database { return db }))
+
+	resp, body := a.do(t, http.MethodGet, "/readyz", "")
+	expectStatus(t, resp, body, http.StatusServiceUnavailable)
+	if !strings.Contains(body, `"status":"not_ready"`) || !strings.Contains(body, `"database":false`) {
+		t.Fatalf("got readiness %s, want not ready for the database", body)
+	}
+
+	resp, body = a.do(t, http.MethodPost, "/tasks", `{"title":"too early"}`)
+	expectStatus(t, resp, body, http.StatusServiceUnavailable)
+	if !strings.Contains(body, `"not_ready"`) {
+		t.Fatalf("got body %s, want code not_ready", body)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "1" {
+		t.Fatalf("got Retry-After %q, want 1", got)
+	}
+
+	// Reads are served
+	resp, body = a.do(t, http.MethodGet, "/tasks", "")
+	expectStatus(t, resp, body, http.StatusOK)
+
+	db.connected.Store(true)
+	resp, body = a.do(t, http.MethodGet, "/readyz", "")
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = a.do(t, http.MethodPost, "/tasks", `{"title":"connected"}`)
+	expectStatus(t, resp, body, http.StatusCreated)
+}
+
+func TestShutdownWaitsForRequests(t *testing.T) {
+	db := &slowDB{}
+	db.connected.Store(true)
+	dbClosed := make(chan struct{})
+	a := startAPI(t, cell.Provide(func(lc cell.Lifecycle) database.Database {
+		lc.Append(cell.Hook{OnStop: func(cell.HookContext) error {
+			db.connected.Store(false)
+			close(dbClosed)
+			return nil
+		}})
+		return db
+	}))
+
+	// The create is in flight until its body is written
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, a.url+"/tasks", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	results := make(chan int, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			results <- 0
+			return
+		}
+		resp.Body.Close()
+		results <- resp.StatusCode
+	}()
+	if _, err := pw.Write([]byte(`{"title":`)); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		_, body := a.do(t, http.MethodGet, "/health", "")
+		if strings.Contains(body, `"in_flight":1`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got health %s, want one request in flight", body)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- a.stop() }()
+
+	// Neither the hive nor the database stops while the request runs
+	select {
+	case err := <-stopped:
+		t.Fatalf("stopped with a request in flight: %v", err)
+	case <-dbClosed:
+		t.Fatal("the database closed with a request in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	pw.Write([]byte(`"slow"}`))
+	pw.Close()
+	if status := <-results; status != http.StatusCreated {
+		t.Fatalf("in-flight create: got status %d, want %d", status, http.StatusCreated)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatalf("stopping: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package apitest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bhargavparmar/hive-demo/pkg/api/apitest"
+	"github.com/bhargavparmar/hive-demo/pkg/tasks"
+)
+
+// exampleTB stands in for the *testing.T a test would pass to New, as
+// examples do not get one
+type exampleTB struct {
+	testing.TB
+	cleanups []func()
+}
+
+func (tb *exampleTB) Helper()          {}
+func (tb *exampleTB) Cleanup(f func()) { tb.cleanups = append(tb.cleanups, f) }
+func (tb *exampleTB) Fatalf(format string, args ...any) {
+	panic(fmt.Sprintf(format, args...))
+}
+
+func (tb *exampleTB) cleanup() {
+	for _, f := range slices.Backward(tb.cleanups) {
+		f()
+	}
+}
+
+func Example() {
+	tb := &exampleTB{}
+	defer tb.cleanup()
+
+	srv := apitest.New(tb)
+
+	resp, err := http.Post(srv.URL+"/tasks", "application/json",
+		strings.NewReader(`{"title":"Write tests"}`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	resp.Body.Close()
+	fmt.Println(resp.StatusCode, resp.Header.Get("Location") != "")
+
+	// The task manager behind the API can be inspected directly
+	count, err := srv.Tasks.Count(context.Background(), tasks.Filter{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(count)
+
+	// Output:
+	// 201 true
+	// 1
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+)
+
+// sensitiveField matches JSON members whose values must not be logged, such
+// as "password" or "api_key", capturing the name and the value
+var sensitiveField = regexp.MustCompile(`(?i)("[\w-]*(?:password|secret|token|api[_-]?key|authorization|cookie)[\w-]*"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+
+// redact replaces the values of sensitive JSON members with a placeholder.
+// It works on truncated bodies that are no longer valid JSON.
+func redact(body []byte) string {
+	return sensitiveField.ReplaceAllString(string(body), `${1}"[REDACTED]"`)
+}
+
+// bodyLogMiddleware logs the first LogBodyMaxBytes of every request and
+// response body at debug level, with sensitive fields redacted. It does
+// nothing unless enabled in the configuration and the logger has debug
+// level enabled.
+func (s *server) bodyLogMiddleware(next http.Handler) http.Handler {
+	if !s.cfg.LogBodies || s.cfg.LogBodyMaxBytes <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.logger.Enabled(r.Context(), slog.LevelDebug) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Body != nil && r.Body != http.NoBody {
+			// Buffer only what is logged and put it back in front of the
+			// rest of the body, so the handler still reads all of it
+			prefix, err := io.ReadAll(io.LimitReader(r.Body, int64(s.cfg.LogBodyMaxBytes)+1))
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(prefix), r.Body), r.Body}
+			if err == nil {
+				s.logBody("Request body", r, prefix)
+			}
+		}
+
+		bw := &bodyRecorder{ResponseWriter: w, limit: s.cfg.LogBodyMaxBytes + 1}
+		next.ServeHTTP(bw, r)
+		s.logBody("Response body", r, bw.buf.Bytes())
+	})
+}
+
+// logBody logs a body captured with one byte more than the limit, so
+// truncation can be detected
+func (s *server) logBody(msg string, r *http.Request, body []byte) {
+	truncated := len(body) > s.cfg.LogBodyMaxBytes
+	if truncated {
+		body = body[:s.cfg.LogBodyMaxBytes]
+	}
+
+	s.logger.Debug(msg,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"body", redact(body),
+		"truncated", truncated,
+	)
+}
+
+// readCloser reads from one reader and closes another
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyRecorder keeps a copy of the start of the response body
+type bodyRecorder struct {
+	http.ResponseWriter
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	if n := w.limit - w.buf.Len(); n > 0 {
+		w.buf.Write(b[:min(n, len(b))])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working through the recorder
+func (w *bodyRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *bodyRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Middleware wraps a handler with additional behavior
+type Middleware func(http.Handler) http.Handler
+
+// Chain is an ordered list of middleware. The first middleware is the
+// outermost, so it sees each request first and each response last.
+type Chain []Middleware
+
+// NewChain returns a chain of the given middleware, in order
+func NewChain(middleware ...Middleware) Chain {
+	return Chain(slices.Clone(middleware))
+}
+
+// Append returns a new chain with middleware added after the existing
+// ones, leaving c unchanged
+func (c Chain) Append(middleware ...Middleware) Chain {
+	return append(slices.Clip(c), middleware...)
+}
+
+// Then wraps h in every middleware of the chain
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+// defaultChain returns the middleware shared by the public and admin
+// servers, outermost first
+func (s *server) defaultChain() Chain {
+	return NewChain(
+		s.loggingMiddleware,
+		s.gzipMiddleware,
+		s.bodyLogMiddleware,
+		s.timeoutMiddleware,
+		s.prettyMiddleware,
+		s.drainMiddleware,
+		s.concurrencyMiddleware,
+		s.readinessMiddleware,
+		s.maintenanceMiddleware,
+		s.bodyLimitMiddleware,
+		s.featureFlagsMiddleware,
+	)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decodeError describes why a request body could not be decoded
+type decodeError struct {
+	status  int
+	message string
+	field   string
+}
+
+func (e *decodeError) Error() string {
+	return e.message
+}
+
+// decodeJSON decodes a single JSON value from the request body into v,
+// rejecting unknown fields, empty bodies and trailing data. Bodies over the
+// limit set by bodyLimitMiddleware are reported as 413.
+func (s *server) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) *decodeError {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		var maxBytesErr *http.MaxBytesError
+
+		switch {
+		case errors.Is(err, io.EOF):
+			return &decodeError{http.StatusBadRequest, "Request body must not be empty", ""}
+		case errors.As(err, &syntaxErr):
+			return &decodeError{http.StatusBadRequest, fmt.Sprintf("Malformed JSON at position %d", syntaxErr.Offset), ""}
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return &decodeError{http.StatusBadRequest, "Malformed JSON", ""}
+		case errors.As(err, &typeErr):
+			if typeErr.Field != "" {
+				return &decodeError{http.StatusBadRequest, fmt.Sprintf("Invalid value for field: %s", typeErr.Field), typeErr.Field}
+			}
+			return &decodeError{http.StatusBadRequest, fmt.Sprintf("Invalid value at position %d", typeErr.Offset), ""}
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			return &decodeError{http.StatusBadRequest, fmt.Sprintf("Unknown field: %s", field), field}
+		case errors.As(err, &maxBytesErr):
+			return &decodeError{http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit), ""}
+		default:
+			return &decodeError{http.StatusBadRequest, "Invalid request body", ""}
+		}
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return &decodeError{http.StatusBadRequest, "Request body must contain a single JSON value", ""}
+	}
+
+	return nil
+}
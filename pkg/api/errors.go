@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bhargavparmar/hive-demo/pkg/storage"
+	"github.com/bhargavparmar/hive-demo/pkg/tasks"
+)
+
+// Stable error codes returned in error responses. Clients should match on
+// these rather than on the human-readable message.
+const (
+	codeBadRequest       = "bad_request"
+	codeInvalidBody      = "invalid_request_body"
+	codeBodyTooLarge     = "request_too_large"
+	codeValidationFailed = "validation_failed"
+	codeTaskNotFound     = "task_not_found"
+	codeRateLimited      = "rate_limited"
+	codeOpenLimit        = "open_task_limit_exceeded"
+	codePrecondition     = "precondition_failed"
+	codeStorageFull      = "storage_full"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeMaintenance      = "maintenance"
+	codeDraining         = "draining"
+	codeNotReady         = "not_ready"
+	codeOverloaded       = "overloaded"
+	codeClaimHeld        = "claim_held"
+	codeDuplicateTitle   = "duplicate_title"
+	codeFlushDisabled    = "flush_disabled"
+	codeInternal         = "internal_error"
+)
+
+// errorBody is the payload of every error response
+type errorBody struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// jsonError writes a structured error response
+func (s *server) jsonError(w http.ResponseWriter, status int, code, message string) {
+	s.jsonErrorDetails(w, status, code, message, nil)
+}
+
+// jsonErrorDetails writes a structured error response with additional details
+func (s *server) jsonErrorDetails(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	s.jsonResponse(w, status, map[string]errorBody{
+		"error": {Code: code, Message: message, Details: details},
+	})
+}
+
+// decodeErrorResponse writes the error response for a request body that
+// could not be decoded
+func (s *server) decodeErrorResponse(w http.ResponseWriter, err *decodeError) {
+	code := codeInvalidBody
+	if err.status == http.StatusRequestEntityTooLarge {
+		code = codeBodyTooLarge
+	}
+	var details interface{}
+	if err.field != "" {
+		details = map[string]string{"field": err.field}
+	}
+	s.jsonErrorDetails(w, err.status, code, err.message, details)
+}
+
+// taskError writes the error response for an error returned by the task
+// manager, choosing the status and code from the task manager's sentinel
+// errors. Unrecognized errors are reported as internal errors without
+// exposing their message.
+func (s *server) taskError(w http.ResponseWriter, err error) {
+	status, body := s.taskErrorBody(err)
+	s.jsonErrorDetails(w, status, body.Code, body.Message, body.Details)
+}
+
+// taskErrorBody maps an error returned by the task manager to a status code
+// and error payload
+func (s *server) taskErrorBody(err error) (int, errorBody) {
+	var validationErr *tasks.ValidationError
+
+	switch {
+	case errors.As(err, &validationErr):
+		return http.StatusUnprocessableEntity, errorBody{Code: codeValidationFailed, Message: "Task validation failed", Details: validationErr.Fields}
+	case errors.Is(err, tasks.ErrRateLimited):
+		return http.StatusTooManyRequests, errorBody{Code: codeRateLimited, Message: err.Error()}
+	case errors.Is(err, tasks.ErrOpenLimit):
+		return http.StatusConflict, errorBody{Code: codeOpenLimit, Message: err.Error()}
+	case errors.Is(err, tasks.ErrDuplicateTitle):
+		return http.StatusConflict, errorBody{Code: codeDuplicateTitle, Message: err.Error()}
+	case errors.Is(err, tasks.ErrClaimHeld):
+		return http.StatusConflict, errorBody{Code: codeClaimHeld, Message: err.Error()}
+	case errors.Is(err, tasks.ErrVersionMismatch):
+		return http.StatusPreconditionFailed, errorBody{Code: codePrecondition, Message: "Task has been modified; fetch it again to get its current ETag"}
+	case errors.Is(err, storage.ErrFull):
+		return http.StatusInsufficientStorage, errorBody{Code: codeStorageFull, Message: "Task storage is full"}
+	case errors.Is(err, tasks.ErrTaskNotFound):
+		return http.StatusNotFound, errorBody{Code: codeTaskNotFound, Message: err.Error()}
+	case errors.Is(err, tasks.ErrTitleRequired),
+		errors.Is(err, tasks.ErrInvalidStatus),
+		errors.Is(err, tasks.ErrInvalidPatch),
+		errors.Is(err, tasks.ErrInvalidBatch),
+		errors.Is(err, tasks.ErrInvalidImport),
+		errors.Is(err, tasks.ErrInvalidAutocomplete),
+		errors.Is(err, tasks.ErrInvalidID),
+		errors.Is(err, tasks.ErrInvalidMove),
+		errors.Is(err, tasks.ErrInvalidWatcher),
+		errors.Is(err, tasks.ErrInvalidClaim),
+		errors.Is(err, tasks.ErrInvalidTimeSeries):
+		return http.StatusBadRequest, errorBody{Code: codeValidationFailed, Message: err.Error()}
+	default:
+		s.logger.Error("Task manager error", "error", err)
+		return http.StatusInternalServerError, errorBody{Code: codeInternal, Message: "Internal server error"}
+	}
+}
+
+// errorType returns the metrics error category for a task manager error
+func errorType(err error) string {
+	return tasks.ErrorType(err)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bhargavparmar/hive-demo/pkg/tasks"
+)
+
+// etag returns the strong entity tag of a task
+func etag(task *tasks.Task) string {
+	return `"` + task.Version() + `"`
+}
+
+// gzipETagSuffix ends the opaque part of the strong entity tag of a
+// gzip-compressed response
+const gzipETagSuffix = "-gzip"
+
+// gzipETag returns the entity tag of the compressed form of a response
+// tagged tag. Weak tags are kept, as they only claim the content is
+// equivalent.
+func gzipETag(tag string) string {
+	if strings.HasPrefix(tag, "W/") || !strings.HasSuffix(tag, `"`) {
+		return tag
+	}
+	return strings.TrimSuffix(tag, `"`) + gzipETagSuffix + `"`
+}
+
+// identityETag undoes gzipETag, so that a tag from a compressed response
+// matches the tag of the uncompressed one
+func identityETag(tag string) string {
+	if opaque, ok := strings.CutSuffix(tag, gzipETagSuffix+`"`); ok {
+		return opaque + `"`
+	}
+	return tag
+}
+
+// listETag returns the weak entity tag of the task list. It is derived
+// from the task manager's list version instead of the list contents, so it
+// is cheap to compute but only says that nothing has changed, not what.
+func (s *server) listETag() string {
+	return `W/"` + s.taskManager.ListVersion() + `"`
+}
+
+// noneMatch reports whether the If-None-Match header lists tag, in either
+// its compressed or uncompressed form, or "*", using the weak comparison
+// the header calls for
+func noneMatch(r *http.Request, tag string) bool {
+	opaque := strings.TrimPrefix(tag, "W/")
+	for _, v := range r.Header.Values("If-None-Match") {
+		for _, t := range strings.Split(v, ",") {
+			t = identityETag(strings.TrimSpace(t))
+			if t == "*" || strings.TrimPrefix(t, "W/") == opaque {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ifMatch returns the task versions listed in the If-Match header. It
+// returns nil, meaning any version, when the header is absent or "*".
+// Weak tags never match, as If-Match uses strong comparison, so a header
+// listing only weak tags yields an empty list that matches nothing. The
+// tag of a compressed response names the same version as the uncompressed
+// one.
+func ifMatch(r *http.Request) []string {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 {
+		return nil
+	}
+
+	versions := []string{}
+	for _, v := range values {
+		for _, tag := range strings.Split(v, ",") {
+			tag = strings.TrimSpace(tag)
+			switch {
+			case tag == "*":
+				return nil
+			case strings.HasPrefix(tag, "W/"), tag == "":
+				continue
+			}
+			versions = append(versions, strings.Trim(identityETag(tag), `"`))
+		}
+	}
+	return versions
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+	"github.com/bhargavparmar/hive-demo/pkg/tasks"
+)
+
+// taskFields maps the JSON name of each task field to its struct field index
+var taskFields = jsonFieldIndex(reflect.TypeOf(tasks.Task{}))
+
+// jsonFieldIndex maps the JSON names of a struct's exported fields to their
+// indexes
+func jsonFieldIndex(t reflect.Type) map[string]int {
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		fields[name] = i
+	}
+	return fields
+}
+
+// fieldSelection parses the comma-separated fields query parameter. A nil
+// selection means every field. On an unknown field it writes a 400 response
+// and reports false.
+func (s *server) fieldSelection(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	v := r.URL.Query().Get("fields")
+	if v == "" {
+		return nil, true
+	}
+
+	fields := strings.Split(v, ",")
+	for i, name := range fields {
+		name = strings.TrimSpace(name)
+		if _, ok := taskFields[name]; !ok {
+			s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+			s.jsonErrorDetails(w, http.StatusBadRequest, codeBadRequest, "Unknown field: "+name, map[string]string{"field": name})
+			return nil, false
+		}
+		fields[i] = name
+	}
+
+	return fields, true
+}
+
+// project returns the selected fields of a task, or the task itself when
+// fields is nil. Selected fields are included even when empty.
+func project(task *tasks.Task, fields []string) interface{} {
+	if fields == nil {
+		return task
+	}
+
+	v := reflect.ValueOf(task).Elem()
+	out := make(map[string]interface{}, len(fields))
+	for _, name := range fields {
+		out[name] = v.Field(taskFields[name]).Interface()
+	}
+	return out
+}
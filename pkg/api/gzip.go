@@ -0,0 +1,179 @@
+package api
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipLevelNames are the named values of --api-gzip-level besides 1 to 9
+var gzipLevelNames = map[string]int{
+	"best-speed":       gzip.BestSpeed,
+	"best-compression": gzip.BestCompression,
+	"default":          gzip.DefaultCompression,
+}
+
+// gzipOff is the --api-gzip-level that disables compression
+const gzipOff = "off"
+
+// gzipPool reuses gzip writers of one compression level, as each holds
+// several hundred kilobytes of compressor state
+type gzipPool struct {
+	level int
+	pool  sync.Pool
+}
+
+// newGzipPool returns a pool for the configured --api-gzip-level, or nil if
+// compression is off
+func newGzipPool(level string) (*gzipPool, error) {
+	if level == gzipOff {
+		return nil, nil
+	}
+
+	n, ok := gzipLevelNames[level]
+	if !ok {
+		var err error
+		n, err = strconv.Atoi(level)
+		if err != nil || n < gzip.BestSpeed || n > gzip.BestCompression {
+			return nil, fmt.Errorf("api-gzip-level must be 1 to 9, best-speed, best-compression, default or off, got %q", level)
+		}
+	}
+	return &gzipPool{level: n}, nil
+}
+
+// get returns a writer compressing to w
+func (p *gzipPool) get(w io.Writer) *gzip.Writer {
+	if gz, ok := p.pool.Get().(*gzip.Writer); ok {
+		gz.Reset(w)
+		return gz
+	}
+	// The level has been validated, so this cannot fail
+	gz, _ := gzip.NewWriterLevel(w, p.level)
+	return gz
+}
+
+// put returns a closed writer to the pool
+func (p *gzipPool) put(gz *gzip.Writer) {
+	gz.Reset(io.Discard)
+	p.pool.Put(gz)
+}
+
+// gzipMiddleware compresses response bodies for clients that accept gzip.
+// Responses that have no body or are already encoded are left alone, as are
+// WebSocket upgrades. A compressed response is a different representation,
+// so a strong entity tag gets gzipETagSuffix; conditional requests accept
+// either tag.
+func (s *server) gzipMiddleware(next http.Handler) http.Handler {
+	if s.gzip == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) || strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: w, pool: s.gzip, head: r.Method == http.MethodHead}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the Accept-Encoding header lists gzip with a
+// non-zero quality
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, enc := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(enc, ";")
+			if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+				continue
+			}
+			q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+			if !ok {
+				return true
+			}
+			quality, err := strconv.ParseFloat(q, 64)
+			return err == nil && quality > 0
+		}
+	}
+	return false
+}
+
+// gzipWriter compresses the body written through it, deciding whether to
+// when the status is written
+type gzipWriter struct {
+	http.ResponseWriter
+	pool *gzipPool
+	head bool
+
+	wroteHeader bool
+	// gz is nil unless the response is being compressed
+	gz *gzip.Writer
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	// Informational responses come before the real one
+	if status < http.StatusOK || w.wroteHeader {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if !w.head && status != http.StatusNoContent && status != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = w.pool.get(w.ResponseWriter)
+	}
+	// A 304 confirms the compressed response the client has cached
+	if tag := h.Get("ETag"); tag != "" && (w.gz != nil || status == http.StatusNotModified && h.Get("Content-Encoding") == "") {
+		h.Set("ETag", gzipETag(tag))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		// The server would sniff the compressed bytes instead
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+// Flush sends what has been compressed so far, keeping streaming responses
+// working
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close finishes the compressed body and returns the writer to the pool
+func (w *gzipWriter) close() {
+	if w.gz == nil {
+		return
+	}
+	w.gz.Close()
+	w.pool.put(w.gz)
+	w.gz = nil
+}
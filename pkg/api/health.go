@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+)
+
+// healthCheck is the result of checking the dependencies of the server
+type healthCheck struct {
+	checkedAt  time.Time
+	databaseOK bool
+	storage    map[string]interface{}
+	storageOK  bool
+}
+
+// handleHealth reports the service health from a cached dependency check
+// that is at most HealthCacheInterval old. A draining server, or one whose
+// database is unreachable, answers 503 so load balancers stop routing to it.
+// A server whose storage is nearly full, or cannot be counted, is degraded
+// but keeps answering 200.
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	check := s.health.Load()
+	if check == nil || time.Since(check.checkedAt) > s.cfg.HealthCacheInterval {
+		check = s.checkHealth(r.Context())
+	}
+
+	status, code := "healthy", http.StatusOK
+	switch {
+	case s.draining.Load():
+		status, code = "draining", http.StatusServiceUnavailable
+	case !check.databaseOK:
+		status, code = "unhealthy", http.StatusServiceUnavailable
+	case !check.storageOK:
+		status = "degraded"
+	}
+
+	database := "ok"
+	if !check.databaseOK {
+		database = "unavailable"
+	}
+
+	response := map[string]interface{}{
+		"status":      status,
+		"time":        time.Now().Format(time.RFC3339),
+		"checked_at":  check.checkedAt.Format(time.RFC3339Nano),
+		"maintenance": s.maintenance.Load(),
+		"in_flight":   s.inFlight.Load(),
+		"database":    database,
+		"storage":     check.storage,
+	}
+	s.addUptime(response)
+	s.jsonResponse(w, code, response)
+}
+
+// ready reports whether the server may take writes: it has finished
+// starting, which happens after storage and the task manager have, is not
+// stopping or draining, and the database is connected
+func (s *server) ready() bool {
+	return s.started.Load() && !s.draining.Load() && s.db.IsConnected()
+}
+
+// handleReady answers 200 once the server is ready and 503 before then, for
+// orchestrators that should only route traffic to ready instances. Unlike
+// /health it checks the current state rather than pinging the database.
+func (s *server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, readMethods) {
+		return
+	}
+
+	status, code := "ready", http.StatusOK
+	if !s.ready() {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+
+	s.jsonResponse(w, code, map[string]interface{}{
+		"status":   status,
+		"started":  s.started.Load(),
+		"draining": s.draining.Load(),
+		"database": s.db.IsConnected(),
+	})
+}
+
+// checkHealth checks the dependencies of the server and stores the result
+// for later probes
+func (s *server) checkHealth(ctx context.Context) *healthCheck {
+	check := &healthCheck{checkedAt: time.Now(), databaseOK: true}
+
+	if err := s.db.Ping(ctx); err != nil {
+		s.logger.Error("Database health check failed", "error", err)
+		check.databaseOK = false
+	}
+	check.storage, check.storageOK = s.storageUsage(ctx)
+
+	s.health.Store(check)
+	return check
+}
+
+// monitorHealth refreshes the cached health check every HealthCacheInterval
+// until ctx is cancelled, so probes rarely have to wait for a check
+func (s *server) monitorHealth(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.HealthCacheInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, s.cfg.HealthCacheInterval)
+			s.checkHealth(checkCtx)
+			cancel()
+		}
+	}
+}
+
+// storageUsage reports how full the storage is. The percentage is only
+// given for bounded storage. It reports false when the storage is fuller
+// than the degraded threshold or its items cannot be counted.
+func (s *server) storageUsage(ctx context.Context) (map[string]interface{}, bool) {
+	used, err := s.storage.Count(ctx)
+	if err != nil {
+		s.logger.Error("Failed to count storage items for health check", "error", err)
+		return map[string]interface{}{"error": "unavailable"}, false
+	}
+
+	max := s.storage.Capacity()
+	usage := map[string]interface{}{"used": used, "max": max}
+	if max > 0 {
+		percent := float64(used) / float64(max) * 100
+		usage["percent"] = math.Round(percent*10) / 10
+		return usage, percent <= s.cfg.StorageDegradedPercent
+	}
+	return usage, true
+}
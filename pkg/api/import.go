@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+)
+
+// importFormField is the multipart form field holding an uploaded CSV file
+const importFormField = "file"
+
+// importRowError is the error reported for one skipped row of an import
+type importRowError struct {
+	Line  int       `json:"line"`
+	Error errorBody `json:"error"`
+}
+
+// handleImportCSV creates tasks from a CSV file sent either as the request
+// body or as the file field of a multipart form
+func (s *server) handleImportCSV(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, actionMethods) {
+		return
+	}
+
+	body, err := importBody(r)
+	if err != nil {
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonError(w, http.StatusBadRequest, codeInvalidBody, err.Error())
+		return
+	}
+	defer body.Close()
+
+	result, err := s.taskManager.ImportCSV(r.Context(), body)
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		s.jsonError(w, http.StatusRequestEntityTooLarge, codeBodyTooLarge,
+			fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit))
+		return
+	case err != nil:
+		s.metrics.IncrementErrorsByType(errorType(err))
+		s.taskError(w, err)
+		return
+	}
+
+	errs := make([]importRowError, len(result.Errors))
+	for i, e := range result.Errors {
+		_, body := s.taskErrorBody(e.Err)
+		errs[i] = importRowError{Line: e.Line, Error: body}
+	}
+
+	s.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"created": len(result.Tasks),
+		"failed":  len(result.Errors),
+		"tasks":   result.Tasks,
+		"errors":  errs,
+	})
+}
+
+// importBody returns the CSV file of an import request
+func importBody(r *http.Request) (io.ReadCloser, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid multipart body: %v", err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("Missing form field: %s", importFormField)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid multipart body: %v", err)
+		}
+		if part.FormName() == importFormField {
+			return part, nil
+		}
+		part.Close()
+	}
+}
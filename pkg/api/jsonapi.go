@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/bhargavparmar/hive-demo/pkg/tasks"
+)
+
+// jsonAPIMediaType is the media type of JSON:API documents
+const jsonAPIMediaType = "application/vnd.api+json"
+
+// jsonAPIResource is a JSON:API resource object
+type jsonAPIResource struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// taskFieldNames lists the JSON names of the task fields in declaration order
+var taskFieldNames = func() []string {
+	names := make([]string, len(taskFields))
+	for name, i := range taskFields {
+		names[i] = name
+	}
+	return names
+}()
+
+// wantsJSONAPI reports whether the client asked for JSON:API documents
+func wantsJSONAPI(r *http.Request) bool {
+	return accepts(r, jsonAPIMediaType)
+}
+
+// accepts reports whether the Accept header of r lists mediaType
+func accepts(r *http.Request, mediaType string) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mt := range strings.Split(accept, ",") {
+			mt, _, _ = strings.Cut(mt, ";")
+			if strings.TrimSpace(mt) == mediaType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// taskResource converts a task to a JSON:API resource. The ID becomes the
+// resource ID and the selected fields, or all fields when fields is nil,
+// become its attributes.
+func taskResource(task *tasks.Task, fields []string) jsonAPIResource {
+	if fields == nil {
+		fields = taskFieldNames
+	}
+
+	v := reflect.ValueOf(task).Elem()
+	attrs := make(map[string]interface{}, len(fields))
+	for _, name := range fields {
+		if name == "id" {
+			continue
+		}
+		attrs[name] = v.Field(taskFields[name]).Interface()
+	}
+
+	return jsonAPIResource{Type: "tasks", ID: task.ID, Attributes: attrs}
+}
+
+// taskResponse writes a single task, as a JSON:API document if the client
+// asked for one and as plain JSON otherwise. Warnings go in a warnings
+// member, or under meta in JSON:API documents; they are only given for
+// writes, which never select fields.
+func (s *server) taskResponse(w http.ResponseWriter, r *http.Request, status int, task *tasks.Task, fields []string, warnings []tasks.Warning) {
+	if !wantsJSONAPI(r) {
+		if len(warnings) > 0 {
+			s.jsonResponse(w, status, withWarnings(task, warnings))
+			return
+		}
+		s.jsonResponse(w, status, project(task, fields))
+		return
+	}
+
+	doc := map[string]interface{}{"data": taskResource(task, fields)}
+	if len(warnings) > 0 {
+		doc["meta"] = map[string]interface{}{"warnings": warnings}
+	}
+
+	w.Header().Set("Content-Type", jsonAPIMediaType)
+	w.WriteHeader(status)
+	newEncoder(w).Encode(doc)
+}
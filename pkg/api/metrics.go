@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+)
+
+// openMetricsMediaType selects the OpenMetrics format for GET /metrics
+const openMetricsMediaType = "application/openmetrics-text"
+
+// handleMetrics exposes the collected metrics for scraping. Clients that
+// accept OpenMetrics get that format, everyone else the Prometheus text
+// format.
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.handleMethods(w, r, readMethods) {
+		return
+	}
+
+	write, contentType := metrics.WritePrometheus, metrics.PrometheusContentType
+	if accepts(r, openMetricsMediaType) {
+		write, contentType = metrics.WriteOpenMetrics, metrics.OpenMetricsContentType
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(http.StatusOK)
+	if err := write(w, s.metrics.Families()); err != nil {
+		s.logger.Warn("Writing metrics failed", "error", err)
+	}
+}
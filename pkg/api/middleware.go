@@ -0,0 +1,415 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/features"
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+	"github.com/bhargavparmar/hive-demo/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware for logging requests. Requests slower than the configured
+// threshold are logged at warn level so they stand out.
+func (s *server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		s.metrics.IncrementRequests()
+
+		s.logger.Info("Request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote", r.RemoteAddr,
+		)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		duration := time.Since(start)
+
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.code(),
+			"duration", duration,
+		}
+		if s.cfg.SlowRequestThreshold > 0 && duration > s.cfg.SlowRequestThreshold {
+			s.logger.Warn("Response", append(attrs, "slow", true)...)
+		} else {
+			s.logger.Info("Response", attrs...)
+		}
+
+		if s.requestLog != nil {
+			s.requestLog.add(requestLogEntry{
+				Time:       start,
+				RequestID:  r.Header.Get("X-Request-ID"),
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Status:     rec.code(),
+				DurationMS: float64(duration) / float64(time.Millisecond),
+			})
+		}
+	})
+}
+
+// routeMetricsMiddleware counts each request by the pattern of the route
+// of mux that serves it, such as /tasks/{id}, rather than by its path, so
+// task IDs do not become metric labels. Requests needing a redirect to a
+// clean path match no route. It must wrap the middleware that replaces the
+// response writer, as handlers look for their own writer types.
+func (s *server) routeMetricsMiddleware(mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routePattern(mux, r)
+			if route == "" {
+				route = "unmatched"
+			}
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			s.metrics.IncrementRouteRequests(r.Method, route, rec.code())
+		})
+	}
+}
+
+// routePattern returns the pattern of the route of mux that serves r, or
+// "" if none does
+func routePattern(mux *http.ServeMux, r *http.Request) string {
+	_, route := mux.Handler(r)
+	return route
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// code returns the status code sent to the client
+func (w *statusRecorder) code() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Flush keeps streaming responses working through the recorder
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// tracingMiddleware starts a server span for every request, continuing the
+// trace from an incoming traceparent header when present. Spans are named
+// after the method and the pattern of the route of mux, such as
+// GET /tasks/{id}, so task IDs do not multiply the span names; the path is
+// recorded as an attribute.
+func (s *server) tracingMiddleware(mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attrs := []attribute.KeyValue{
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+			}
+			name := r.Method
+			if route := routePattern(mux, r); route != "" {
+				name = r.Method + " " + route
+				attrs = append(attrs, attribute.String("http.route", route))
+			}
+
+			ctx := tracing.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := s.tracer.Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(attrs...),
+			)
+			defer span.End()
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			status := rec.code()
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
+
+// prettyWriter marks a response whose JSON body should be indented
+type prettyWriter struct {
+	http.ResponseWriter
+	pretty bool
+}
+
+// Flush keeps streaming responses working through the writer
+func (w *prettyWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *prettyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// prettyMiddleware decides whether JSON responses are indented, using the
+// pretty query parameter or the configured default
+func (s *server) prettyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pw := &prettyWriter{ResponseWriter: w, pretty: s.cfg.PrettyJSON}
+
+		if v := r.URL.Query().Get("pretty"); v != "" {
+			pretty, err := strconv.ParseBool(v)
+			if err != nil {
+				s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+				s.jsonError(pw, http.StatusBadRequest, codeBadRequest, "Invalid value for pretty: "+v)
+				return
+			}
+			pw.pretty = pretty
+		}
+
+		next.ServeHTTP(pw, r)
+	})
+}
+
+// drainMiddleware counts in-flight requests and, once the server is
+// draining, rejects new ones with a 503. Health checks and admin requests
+// are always served and are not counted, so an operator can poll the
+// in-flight count until it reaches zero.
+func (s *server) drainMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isControlRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Count the request before checking the flag so that a request
+		// admitted concurrently with the drain still shows up as in flight
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+
+		if s.draining.Load() {
+			w.Header().Set("Connection", "close")
+			s.jsonError(w, http.StatusServiceUnavailable, codeDraining, "Server is draining; retry against another instance")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isControlRequest reports whether the request is a health or readiness
+// check or an admin request, which stay available while draining, in
+// maintenance or not yet ready
+func isControlRequest(r *http.Request) bool {
+	return r.URL.Path == "/health" || r.URL.Path == "/readyz" || strings.HasPrefix(r.URL.Path, "/admin/")
+}
+
+// notReadyRetryAfter is how long clients are asked to wait before retrying
+// a write rejected because the server is not ready
+const notReadyRetryAfter = time.Second
+
+// readinessMiddleware rejects mutating requests with a 503 while the server
+// is serving but not ready, so no write can reach storage before the
+// database is connected or after the server begins to stop. Reads are
+// served and fail on their own if a dependency is missing. Handlers served
+// without starting the server, as apitest does, are not gated.
+func (s *server) readinessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.serving.Load() || !isMutating(r.Method) || isControlRequest(r) || s.ready() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(notReadyRetryAfter.Seconds())))
+		s.jsonError(w, http.StatusServiceUnavailable, codeNotReady, "Service is not ready; retry shortly")
+	})
+}
+
+// overloadedRetryAfter is how long clients are asked to wait before
+// retrying a request rejected by the concurrency limit
+const overloadedRetryAfter = time.Second
+
+// concurrencyMiddleware rejects requests with a 503 while MaxConcurrent
+// requests are already being handled, rather than queuing them. Streaming
+// requests, which stay open for long, are not limited and do not take a
+// slot, and neither are health checks, admin requests, /stats and /metrics,
+// so the service can still be watched while it is saturated.
+func (s *server) concurrencyMiddleware(next http.Handler) http.Handler {
+	if s.concurrency == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isControlRequest(r) || isStreamingRequest(r) || r.URL.Path == "/stats" || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case s.concurrency <- struct{}{}:
+			defer func() { <-s.concurrency }()
+			next.ServeHTTP(w, r)
+		default:
+			s.metrics.IncrementErrorsByType(metrics.ErrorRateLimited)
+			w.Header().Set("Retry-After", strconv.Itoa(int(overloadedRetryAfter.Seconds())))
+			s.jsonError(w, http.StatusServiceUnavailable, codeOverloaded, "Too many requests in progress; retry shortly")
+		}
+	})
+}
+
+// maintenanceRetryAfter is how long clients are asked to wait before
+// retrying a write rejected by maintenance mode
+const maintenanceRetryAfter = 30 * time.Second
+
+// maintenanceMiddleware rejects mutating requests with a 503 while
+// maintenance mode is on. Reads and the admin routes, which turn maintenance
+// mode off again, are always served.
+func (s *server) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.maintenance.Load() || !isMutating(r.Method) || isControlRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetryAfter.Seconds())))
+		s.jsonError(w, http.StatusServiceUnavailable, codeMaintenance, "Service is in maintenance mode; writes are disabled")
+	})
+}
+
+// featureFlagsMiddleware turns on the feature flags named by the
+// X-Feature-Flags header for the request, see features.Enabled
+func (s *server) featureFlagsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(features.Header)
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(features.WithFlags(r.Context(), features.Parse(header))))
+	})
+}
+
+// isMutating reports whether requests with the given method change state
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// bodyLimitMiddleware caps the size of request bodies. Requests that declare
+// a larger body are rejected up front; others fail with a 413 once the
+// handler reads past the limit.
+func (s *server) bodyLimitMiddleware(next http.Handler) http.Handler {
+	if s.cfg.MaxBodyBytes <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > s.cfg.MaxBodyBytes {
+			s.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+			s.jsonError(w, http.StatusRequestEntityTooLarge, codeBodyTooLarge,
+				fmt.Sprintf("Request body must not be larger than %d bytes", s.cfg.MaxBodyBytes))
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// timeoutBody is the response sent when a request exceeds the timeout
+const timeoutBody = `{"error":{"code":"request_timeout","message":"Request timed out"}}`
+
+// timeoutMiddleware bounds how long a handler may run. When the deadline
+// passes the client receives a 503 and the request context is cancelled so
+// downstream work stops. Streaming requests are exempt because
+// http.TimeoutHandler buffers the whole response.
+func (s *server) timeoutMiddleware(next http.Handler) http.Handler {
+	if s.cfg.RequestTimeout <= 0 {
+		return next
+	}
+
+	counted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		stop := context.AfterFunc(ctx, func() {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				s.metrics.IncrementErrorsByType(metrics.ErrorTimeout)
+				s.logger.Warn("Request timed out",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"timeout", s.cfg.RequestTimeout,
+				)
+			}
+		})
+		defer stop()
+
+		next.ServeHTTP(w, r)
+	})
+	timeout := http.TimeoutHandler(counted, s.cfg.RequestTimeout, timeoutBody)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStreamingRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// TimeoutHandler writes its timeout body without a content type.
+		// Handlers that complete in time replace this header.
+		w.Header().Set("Content-Type", "application/json")
+		timeout.ServeHTTP(w, r)
+	})
+}
+
+// isStreamingRequest reports whether the response is streamed to the client
+// rather than written in one go
+func isStreamingRequest(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return true
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return true
+	}
+	// Profiles and execution traces are collected over a requested duration
+	if strings.HasPrefix(r.URL.Path, "/debug/pprof/") {
+		return true
+	}
+	// The export is streamed element by element. The task list is written
+	// the same way, but it is the most expensive read, so it stays under
+	// the request timeout and the concurrency limit like any other.
+	return r.URL.Path == "/tasks/stream" &&
+		(r.Method == http.MethodGet || r.Method == http.MethodHead)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingNamesSpansAfterRoutes(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	s := &server{tracer: tp.Tracer("test")}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	handler := s.tracingMiddleware(mux)(mux)
+
+	for _, path := range []string{"/tasks/task-1", "/tasks/task-2", "/nowhere"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	for i, want := range []struct{ name, path string }{
+		{"GET /tasks/{id}", "/tasks/task-1"},
+		{"GET /tasks/{id}", "/tasks/task-2"},
+		{"GET", "/nowhere"},
+	} {
+		if got := spans[i].Name(); got != want.name {
+			t.Errorf("span %d: got name %q, want %q", i, got, want.name)
+		}
+		var path string
+		for _, attr := range spans[i].Attributes() {
+			if attr.Key == attribute.Key("url.path") {
+				path = attr.Value.AsString()
+			}
+		}
+		if path != want.path {
+			t.Errorf("span %d: got url.path %q, want %q", i, path, want.path)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// normalizeBasePath turns a configured base path such as "api", "/api" or
+// "/api/" into "/api". The root path becomes "", meaning no base path.
+func normalizeBasePath(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// mountAt serves h under basePath, as normalized by normalizeBasePath, with
+// the prefix stripped so h sees the same paths as without one. Requests
+// outside the base path get 404, and a request for the base path without a
+// trailing slash is redirected to the root below it.
+func mountAt(basePath string, h http.Handler) http.Handler {
+	if basePath == "" {
+		return h
+	}
+
+	strip := http.StripPrefix(basePath, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == basePath:
+			target := basePath + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, basePath+"/"):
+			strip.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bhargavparmar/hive-demo/pkg/tasks"
+)
+
+const (
+	// defaultPageSize is the limit of a page when only an offset is given
+	defaultPageSize = 100
+	// maxPageSize is the largest limit a client may ask for
+	maxPageSize = 1000
+)
+
+// page is the part of a list requested with ?limit and ?offset
+type page struct {
+	limit  int
+	offset int
+}
+
+// pageParams parses the limit and offset query parameters, reporting false
+// if neither is given and the whole list is wanted
+func pageParams(r *http.Request) (page, bool, error) {
+	q := r.URL.Query()
+	if !q.Has("limit") && !q.Has("offset") {
+		return page{}, false, nil
+	}
+
+	p := page{limit: defaultPageSize}
+	if v := q.Get("limit"); q.Has("limit") {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return page{}, false, fmt.Errorf("Invalid value for limit: %s; must be between 1 and %d", v, maxPageSize)
+		}
+		p.limit = limit
+	}
+	if v := q.Get("offset"); q.Has("offset") {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return page{}, false, fmt.Errorf("Invalid value for offset: %s", v)
+		}
+		p.offset = offset
+	}
+
+	return p, true, nil
+}
+
+// slice returns the tasks of the page
+func (p page) slice(list []*tasks.Task) []*tasks.Task {
+	start := min(p.offset, len(list))
+	end := min(start+p.limit, len(list))
+	return list[start:end]
+}
+
+// links returns the URLs of the page and, where they hold any tasks, the
+// pages before and after it. The URLs keep the request's other query
+// parameters and include the base path.
+func (s *server) pageLinks(r *http.Request, p page, total int) map[string]string {
+	link := func(offset int) string {
+		q := r.URL.Query()
+		q.Set("limit", strconv.Itoa(p.limit))
+		q.Set("offset", strconv.Itoa(offset))
+		return s.link(r.URL.Path) + "?" + q.Encode()
+	}
+
+	links := map[string]string{"self": link(p.offset)}
+	// Compared this way round, as offset+limit overflows for huge offsets
+	if p.offset < total-p.limit {
+		links["next"] = link(p.offset + p.limit)
+	}
+	if p.offset > 0 && total > 0 {
+		// A page past the end links back to the last page
+		links["prev"] = link(max(0, min(p.offset, total)-p.limit))
+	}
+	return links
+}
+
+// taskPage is a page of the task list in plain JSON
+type taskPage struct {
+	Tasks  []interface{}     `json:"tasks"`
+	Total  int               `json:"total"`
+	Limit  int               `json:"limit"`
+	Offset int               `json:"offset"`
+	Links  map[string]string `json:"_links"`
+}
+
+// pageResponse writes one page of list, with links to navigate to the
+// neighbouring pages. JSON:API documents carry the links in their links
+// member and the total under meta.
+func (s *server) pageResponse(w http.ResponseWriter, r *http.Request, list []*tasks.Task, fields []string, p page) {
+	items := p.slice(list)
+	links := s.pageLinks(r, p, len(list))
+
+	if wantsJSONAPI(r) {
+		data := make([]jsonAPIResource, len(items))
+		for i, task := range items {
+			data[i] = taskResource(task, fields)
+		}
+
+		w.Header().Set("Content-Type", jsonAPIMediaType)
+		w.WriteHeader(http.StatusOK)
+		newEncoder(w).Encode(map[string]interface{}{
+			"data":  data,
+			"links": links,
+			"meta":  map[string]int{"total": len(list)},
+		})
+		return
+	}
+
+	resp := taskPage{
+		Tasks:  make([]interface{}, len(items)),
+		Total:  len(list),
+		Limit:  p.limit,
+		Offset: p.offset,
+		Links:  links,
+	}
+	for i, task := range items {
+		resp.Tasks[i] = project(task, fields)
+	}
+	s.jsonResponse(w, http.StatusOK, resp)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"math"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestPageLinks(t *testing.T) {
+	s := &server{}
+
+	for _, tc := range []struct {
+		offset, limit, total int
+		next, prev           bool
+	}{
+		{offset: 0, limit: 10, total: 25, next: true},
+		{offset: 10, limit: 10, total: 25, next: true, prev: true},
+		{offset: 20, limit: 10, total: 25, prev: true},
+		{offset: 0, limit: 10, total: 10},
+		{offset: 30, limit: 10, total: 25, prev: true},
+		{offset: math.MaxInt, limit: 10, total: 25, prev: true},
+		{offset: math.MaxInt - 5, limit: 10, total: 25, prev: true},
+	} {
+		name := strconv.Itoa(tc.offset) + "+" + strconv.Itoa(tc.limit) + "/" + strconv.Itoa(tc.total)
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/tasks", nil)
+			links := s.pageLinks(r, page{limit: tc.limit, offset: tc.offset}, tc.total)
+
+			if _, ok := links["next"]; ok != tc.next {
+				t.Errorf("got next link %v, want %v: %v", ok, tc.next, links)
+			}
+			if _, ok := links["prev"]; ok != tc.prev {
+				t.Errorf("got prev link %v, want %v: %v", ok, tc.prev, links)
+			}
+		})
+	}
+}
+
+func TestPageSliceHugeOffset(t *testing.T) {
+	if got := (page{limit: 10, offset: math.MaxInt}).slice(nil); len(got) != 0 {
+		t.Fatalf("got %d tasks past the end, want 0", len(got))
+	}
+}
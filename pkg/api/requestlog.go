@@ -0,0 +1,58 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// requestLogEntry records one handled request
+type requestLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// requestLog is a fixed-size ring buffer of the most recent requests
+type requestLog struct {
+	mu      sync.Mutex
+	entries []requestLogEntry
+	next    int
+	full    bool
+}
+
+func newRequestLog(size int) *requestLog {
+	return &requestLog{entries: make([]requestLogEntry, size)}
+}
+
+// add records an entry, overwriting the oldest one once the buffer is full
+func (l *requestLog) add(e requestLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = e
+	l.next++
+	if l.next == len(l.entries) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// recent returns the recorded entries, newest first
+func (l *requestLog) recent() []requestLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+
+	out := make([]requestLogEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return out
+}
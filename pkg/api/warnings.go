@@ -0,0 +1,25 @@
+package api
+
+import "github.com/bhargavparmar/hive-demo/pkg/tasks"
+
+// taskWithWarnings is a written task together with its validation warnings
+type taskWithWarnings struct {
+	*tasks.Task
+	Warnings []tasks.Warning `json:"warnings"`
+}
+
+// withWarnings returns the response body for a written task, adding a
+// warnings member when there are warnings
+func withWarnings(task *tasks.Task, warnings []tasks.Warning) interface{} {
+	if len(warnings) == 0 {
+		return task
+	}
+	return taskWithWarnings{Task: task, Warnings: warnings}
+}
+
+// taskWarnings returns the validation warnings for a task that has already
+// passed validation
+func (s *server) taskWarnings(task *tasks.Task) []tasks.Warning {
+	warnings, _ := s.taskManager.Validate(task)
+	return warnings
+}
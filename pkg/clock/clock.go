@@ -0,0 +1,66 @@
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cilium/hive/cell"
+)
+
+// Cell provides the clock used for timestamps
+var Cell = cell.Module(
+	"clock",
+	"Clock",
+
+	cell.Provide(newClock),
+)
+
+// Clock tells the current time. Components take it as a dependency instead
+// of calling time.Now so tests can control time.
+type Clock interface {
+	Now() time.Time
+}
+
+// wallClock is the real clock
+type wallClock struct{}
+
+func newClock() Clock {
+	return wallClock{}
+}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+// Fake is a clock that only moves when told to. Replace the clock cell's
+// Clock with one in tests to get deterministic timestamps.
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake returns a fake clock set to now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the fake's current time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Set moves the fake clock to t
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = t
+}
+
+// Advance moves the fake clock forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
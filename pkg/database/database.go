@@ -3,8 +3,10 @@ package database
 import (
 	"context"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
 	"github.com/cilium/hive/cell"
 )
 
@@ -13,7 +15,9 @@ var Cell = cell.Module(
 	"database",
 	"Database Connection Manager",
 
-	cell.Provide(newDatabase),
+	metrics.TimeHooks(
+		cell.Provide(newDatabase),
+	),
 )
 
 // Database represents a database connection (simulated)
@@ -23,15 +27,17 @@ type Database interface {
 }
 
 type db struct {
-	logger    *slog.Logger
-	connected bool
+	logger  *slog.Logger
+	metrics metrics.Metrics
+	// connected is read by readiness checks while the hooks change it
+	connected atomic.Bool
 }
 
 // newDatabase creates a new database connection with lifecycle hooks
-func newDatabase(lc cell.Lifecycle, logger *slog.Logger) Database {
+func newDatabase(lc cell.Lifecycle, logger *slog.Logger, m metrics.Metrics) Database {
 	d := &db{
-		logger:    logger.With("component", "database"),
-		connected: false,
+		logger:  logger.With("component", "database"),
+		metrics: m,
 	}
 
 	lc.Append(cell.Hook{
@@ -39,13 +45,13 @@ func newDatabase(lc cell.Lifecycle, logger *slog.Logger) Database {
 			d.logger.Info("Connecting to database...")
 			// Simulate connection time
 			time.Sleep(100 * time.Millisecond)
-			d.connected = true
+			d.connected.Store(true)
 			d.logger.Info("Database connected successfully")
 			return nil
 		},
 		OnStop: func(ctx cell.HookContext) error {
 			d.logger.Info("Closing database connection...")
-			d.connected = false
+			d.connected.Store(false)
 			d.logger.Info("Database connection closed")
 			return nil
 		},
@@ -55,12 +61,23 @@ func newDatabase(lc cell.Lifecycle, logger *slog.Logger) Database {
 }
 
 func (d *db) Ping(ctx context.Context) error {
-	if !d.connected {
-		return context.DeadlineExceeded
-	}
-	return nil
+	return d.observe(func() error {
+		if !d.connected.Load() {
+			return context.DeadlineExceeded
+		}
+		return nil
+	})
+}
+
+// observe runs a database call, recording its duration and outcome in the
+// query metrics
+func (d *db) observe(call func() error) error {
+	start := time.Now()
+	err := call()
+	d.metrics.ObserveQuery(time.Since(start), err)
+	return err
 }
 
 func (d *db) IsConnected() bool {
-	return d.connected
+	return d.connected.Load()
 }
@@ -0,0 +1,53 @@
+package features
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// Feature flags that a request may turn on with the X-Feature-Flags header.
+// Every flag is off unless the request names it.
+const (
+	// StrictValidation rejects writes of tasks that would otherwise be
+	// stored with validation warnings
+	StrictValidation = "strict-validation"
+)
+
+// Known lists every feature flag, in the order they are documented
+var Known = []string{StrictValidation}
+
+// Header is the request header listing the flags turned on, separated by
+// commas
+const Header = "X-Feature-Flags"
+
+type contextKey struct{}
+
+// Parse returns the known flags named in a header value. Names are matched
+// ignoring case and surrounding spaces; unknown names are ignored so that
+// clients may send flags this version does not have.
+func Parse(header string) []string {
+	var flags []string
+	for _, name := range strings.Split(header, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if slices.Contains(Known, name) && !slices.Contains(flags, name) {
+			flags = append(flags, name)
+		}
+	}
+	return flags
+}
+
+// WithFlags returns a copy of ctx with the given flags turned on
+func WithFlags(ctx context.Context, flags []string) context.Context {
+	if len(flags) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, flags)
+}
+
+// Enabled reports whether the flag name is turned on for the request
+// that ctx belongs to
+func Enabled(ctx context.Context, name string) bool {
+	flags, _ := ctx.Value(contextKey{}).([]string)
+	return slices.Contains(flags, name)
+}
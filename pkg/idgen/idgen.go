@@ -0,0 +1,153 @@
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cilium/hive/cell"
+	"github.com/spf13/pflag"
+)
+
+// Cell provides unique ID generation
+var Cell = cell.Module(
+	"idgen",
+	"ID Generator",
+
+	cell.Config(defaultConfig),
+	cell.Provide(newGenerator),
+)
+
+// Supported ID generation strategies
+const (
+	StrategyUUID = "uuid"
+	StrategyULID = "ulid"
+)
+
+// Config holds ID generator configuration
+type Config struct {
+	Strategy string `mapstructure:"id-generator"`
+}
+
+var defaultConfig = Config{
+	Strategy: StrategyUUID,
+}
+
+// Flags implements cell.Flagger
+func (c Config) Flags(flags *pflag.FlagSet) {
+	flags.String("id-generator", c.Strategy, "ID generation strategy (uuid, ulid)")
+}
+
+// Generator generates unique identifiers
+type Generator interface {
+	NewID() string
+}
+
+// newGenerator creates the generator selected by the configuration
+func newGenerator(cfg Config) (Generator, error) {
+	switch cfg.Strategy {
+	case StrategyUUID:
+		return uuidGenerator{}, nil
+	case StrategyULID:
+		return &ulidGenerator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown ID generation strategy %q", cfg.Strategy)
+	}
+}
+
+// uuidGenerator generates random (version 4) UUIDs
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() string {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(fmt.Sprintf("idgen: reading random bytes: %v", err))
+	}
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGenerator generates lexicographically sortable ULIDs. IDs generated
+// within the same millisecond increment the random component so they stay
+// strictly monotonic.
+type ulidGenerator struct {
+	mu      sync.Mutex
+	lastMS  uint64
+	entropy [10]byte
+}
+
+func (g *ulidGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(time.Now().UnixMilli())
+	if ms <= g.lastMS {
+		// Same (or earlier) millisecond: increment the previous entropy
+		ms = g.lastMS
+		if !increment(g.entropy[:]) {
+			// Entropy overflowed, move on to the next millisecond
+			ms++
+			g.randomize()
+		}
+	} else {
+		g.randomize()
+	}
+	g.lastMS = ms
+
+	var id [16]byte
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+	copy(id[6:], g.entropy[:])
+
+	return encodeULID(id)
+}
+
+func (g *ulidGenerator) randomize() {
+	if _, err := rand.Read(g.entropy[:]); err != nil {
+		panic(fmt.Sprintf("idgen: reading random bytes: %v", err))
+	}
+}
+
+// increment adds one to a big-endian byte slice, reporting false on overflow
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID encodes 128 bits as 26 Crockford base32 characters
+func encodeULID(id [16]byte) string {
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+
+	var buf [26]byte
+	for i := 25; i >= 0; i-- {
+		buf[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf[:])
+}
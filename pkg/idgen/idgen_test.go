@@ -0,0 +1,65 @@
+package idgen
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestNewIDUniqueUnderConcurrency(t *testing.T) {
+	const (
+		goroutines = 32
+		perRoutine = 2000
+	)
+
+	for _, strategy := range []string{StrategyUUID, StrategyULID} {
+		t.Run(strategy, func(t *testing.T) {
+			gen, err := newGenerator(Config{Strategy: strategy})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([][]string, goroutines)
+			var wg sync.WaitGroup
+			for g := range goroutines {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ids[g] = make([]string, perRoutine)
+					for i := range ids[g] {
+						ids[g][i] = gen.NewID()
+					}
+				}()
+			}
+			wg.Wait()
+
+			seen := make(map[string]bool, goroutines*perRoutine)
+			for _, batch := range ids {
+				for _, id := range batch {
+					if seen[id] {
+						t.Fatalf("duplicate ID %s", id)
+					}
+					seen[id] = true
+				}
+			}
+		})
+	}
+}
+
+func TestULIDMonotonic(t *testing.T) {
+	gen := &ulidGenerator{}
+
+	prev := gen.NewID()
+	for range 10000 {
+		id := gen.NewID()
+		if id <= prev {
+			t.Fatalf("ID %s does not sort after %s", id, prev)
+		}
+		prev = id
+	}
+}
+
+func TestUnknownStrategy(t *testing.T) {
+	if _, err := newGenerator(Config{Strategy: "sequential"}); err == nil {
+		t.Fatal("expected an error for an unknown strategy")
+	}
+}
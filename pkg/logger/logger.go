@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
 
@@ -31,21 +33,12 @@ func (c Config) Flags(flags *pflag.FlagSet) {
 	flags.String("log-level", c.Level, "Log level (debug, info, warn, error)")
 }
 
-// newLogger creates a new structured logger
+// newLogger creates a new structured logger. Its level is a LevelVar, so
+// it can be changed while running.
 func newLogger(cfg Config) *slog.Logger {
-	var level slog.Level
-
-	switch cfg.Level {
-	case "debug":
-		level = slog.LevelDebug
-	case "info":
-		level = slog.LevelInfo
-	case "warn":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
-	default:
-		level = slog.LevelInfo
+	level := new(slog.LevelVar)
+	if l, err := ParseLevel(cfg.Level); err == nil {
+		level.Set(l)
 	}
 
 	opts := &slog.HandlerOptions{
@@ -59,3 +52,41 @@ func newLogger(cfg Config) *slog.Logger {
 
 	return logger
 }
+
+// ParseLevel parses a level name such as "debug" or "warn", ignoring case.
+// An offset such as "info+2" selects a level in between.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// levelHandler drops the records below a level that can change at any time
+type levelHandler struct {
+	next  slog.Handler
+	level slog.Leveler
+}
+
+// NewLevelHandler returns a handler that passes the records at or above
+// level to next. Pass a *slog.LevelVar to change the level while running.
+func NewLevelHandler(next slog.Handler, level slog.Leveler) slog.Handler {
+	return &levelHandler{next: next, level: level}
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.next.Enabled(ctx, level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{next: h.next.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{next: h.next.WithGroup(name), level: h.level}
+}
@@ -0,0 +1,257 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metric types, as named by the exposition formats
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+)
+
+// Content types of the exposition formats
+const (
+	PrometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// Family is a snapshot of one metric. Name excludes the _total suffix of
+// counters and includes the unit, if any, as OpenMetrics requires.
+type Family struct {
+	Name string
+	Help string
+	Type string
+	Unit string
+	// Created is when the metric started counting
+	Created time.Time
+	Samples []Sample
+}
+
+// Sample is one value of a family. Suffix is appended to the family name,
+// such as "_total" or "_bucket".
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// Label is a name/value pair that distinguishes the samples of a family
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Families returns a snapshot of every metric, in a stable order, followed
+// by the runtime metrics when enabled
+func (m *metrics) Families() []Family {
+	if m.cfg.ResetOnScrape {
+		// Read the counters under the lock too, so that concurrent scrapes
+		// subtract from each other in the order they read
+		m.scrapeMu.Lock()
+		defer m.scrapeMu.Unlock()
+	}
+
+	byType := m.GetErrorsByType()
+	errors := make([]Sample, 0, len(byType))
+	for _, kind := range slices.Sorted(maps.Keys(byType)) {
+		errors = append(errors, Sample{
+			Suffix: "_total",
+			Labels: []Label{{"type", kind}},
+			Value:  float64(byType[kind]),
+		})
+	}
+
+	families := []Family{
+		counter("http_requests", "Requests received by the API server", m.created, m.requests.Load()),
+		{
+			Name:    "http_route_requests",
+			Help:    "Requests handled by the API server by method, route and status",
+			Type:    TypeCounter,
+			Created: m.created,
+			Samples: m.routeSamples(),
+		},
+		{
+			Name:    "errors",
+			Help:    "Failed operations by error type",
+			Type:    TypeCounter,
+			Created: m.created,
+			Samples: errors,
+		},
+		counter("database_queries", "Database queries", m.created, m.queries.Load()),
+		counter("database_query_errors", "Database queries that failed", m.created, m.queryErrors.Load()),
+		{
+			Name:    "database_query_duration_seconds",
+			Help:    "Database query duration",
+			Type:    TypeHistogram,
+			Unit:    "seconds",
+			Created: m.created,
+			Samples: m.queryDuration.samples(),
+		},
+		counter("storage_cache_hits", "Storage reads served from the cache", m.created, m.cacheHits.Load()),
+		counter("storage_cache_misses", "Storage reads that missed the cache", m.created, m.cacheMisses.Load()),
+		counter("worker_jobs_rejected", "Background jobs rejected because the worker queue was full or stopped", m.created, m.rejectedJobs.Load()),
+	}
+	families = append(families, m.hookFamilies()...)
+
+	if m.cfg.GoRuntime {
+		families = append(families, runtimeFamilies()...)
+	}
+	if m.cfg.ResetOnScrape {
+		return m.sinceLastScrape(families)
+	}
+	return families
+}
+
+func counter(name, help string, created time.Time, value int64) Family {
+	return Family{
+		Name:    name,
+		Help:    help,
+		Type:    TypeCounter,
+		Created: created,
+		Samples: []Sample{{Suffix: "_total", Value: float64(value)}},
+	}
+}
+
+// samples returns the bucket, count and sum samples of the histogram
+func (h *histogram) samples() []Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := make([]Sample, 0, len(h.counts)+2)
+	for i, bound := range h.bounds {
+		samples = append(samples, Sample{
+			Suffix: "_bucket",
+			Labels: []Label{{"le", formatBound(bound.Seconds())}},
+			Value:  float64(h.counts[i]),
+		})
+	}
+	count := float64(h.counts[len(h.bounds)])
+	return append(samples,
+		Sample{Suffix: "_bucket", Labels: []Label{{"le", "+Inf"}}, Value: count},
+		Sample{Suffix: "_count", Value: count},
+		Sample{Suffix: "_sum", Value: h.sum.Seconds()},
+	)
+}
+
+// WritePrometheus writes the families in the Prometheus text format. The
+// format has no created timestamps, so they are left out.
+func WritePrometheus(w io.Writer, families []Family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		// Prometheus names counters by their sample, including _total
+		name := f.Name
+		if f.Type == TypeCounter {
+			name += "_total"
+		}
+		bw.WriteString("# HELP " + name + " " + escapeHelp(f.Help) + "\n")
+		bw.WriteString("# TYPE " + name + " " + f.Type + "\n")
+		for _, s := range f.Samples {
+			writeSample(bw, f.Name, s)
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteOpenMetrics writes the families in the OpenMetrics 1.0 text format,
+// with a _created sample for every counter and histogram series and the
+// terminating # EOF line. Samples carry no timestamps, so scrapers use the
+// scrape time.
+func WriteOpenMetrics(w io.Writer, families []Family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		bw.WriteString("# TYPE " + f.Name + " " + f.Type + "\n")
+		if f.Unit != "" {
+			bw.WriteString("# UNIT " + f.Name + " " + f.Unit + "\n")
+		}
+		bw.WriteString("# HELP " + f.Name + " " + escapeHelp(f.Help) + "\n")
+
+		for _, s := range f.Samples {
+			writeSample(bw, f.Name, s)
+		}
+		if !f.Created.IsZero() {
+			created := float64(f.Created.UnixNano()) / float64(time.Second)
+			for _, labels := range seriesLabels(f.Samples) {
+				writeSample(bw, f.Name, Sample{Suffix: "_created", Labels: labels, Value: created})
+			}
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// writeSample writes one sample line
+func writeSample(w *bufio.Writer, name string, s Sample) {
+	w.WriteString(name + s.Suffix)
+	if len(s.Labels) > 0 {
+		w.WriteByte('{')
+		for i, l := range s.Labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l.Name + `="` + escapeLabel(l.Value) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatFloat(s.Value) + "\n")
+}
+
+// seriesLabels returns the label sets of the series in a family: one per
+// counter sample, or a single empty set for a histogram or summary, whose
+// samples together form one series
+func seriesLabels(samples []Sample) [][]Label {
+	var series [][]Label
+	for _, s := range samples {
+		switch s.Suffix {
+		case "_total":
+			series = append(series, s.Labels)
+		case "_count":
+			series = append(series, nil)
+		}
+	}
+	return series
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// formatBound formats a bucket bound in the canonical form OpenMetrics
+// expects, with a decimal point even for whole numbers
+func formatBound(v float64) string {
+	s := formatFloat(v)
+	if !strings.ContainsAny(s, ".In") {
+		s += ".0"
+	}
+	return s
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
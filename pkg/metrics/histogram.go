@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// queryBuckets are the upper bounds of the query duration histogram
+var queryBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// QueryStats summarizes the database queries observed so far
+type QueryStats struct {
+	Total    int64             `json:"queries_total"`
+	Errors   int64             `json:"query_errors_total"`
+	Duration HistogramSnapshot `json:"query_duration"`
+}
+
+// HistogramSnapshot is a point-in-time copy of a duration histogram.
+// Buckets are cumulative, keyed by their upper bound; "+Inf" counts every
+// observation.
+type HistogramSnapshot struct {
+	Buckets    map[string]int64 `json:"buckets"`
+	Count      int64            `json:"count"`
+	SumSeconds float64          `json:"sum_seconds"`
+}
+
+// histogram counts durations into fixed buckets
+type histogram struct {
+	mu     sync.Mutex
+	bounds []time.Duration
+	counts []int64 // counts[i] is the number of observations <= bounds[i]; the last entry is +Inf
+	sum    time.Duration
+}
+
+func newHistogram(bounds []time.Duration) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1),
+	}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.bounds {
+		if d <= bound {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(h.bounds)]++
+	h.sum += d
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := make(map[string]int64, len(h.counts))
+	for i, bound := range h.bounds {
+		buckets[bound.String()] = h.counts[i]
+	}
+	buckets["+Inf"] = h.counts[len(h.bounds)]
+
+	return HistogramSnapshot{
+		Buckets:    buckets,
+		Count:      h.counts[len(h.bounds)],
+		SumSeconds: h.sum.Seconds(),
+	}
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/cilium/hive/cell"
+)
+
+// Lifecycle hook phases recorded by ObserveHook
+const (
+	HookStart = "start"
+	HookStop  = "stop"
+)
+
+// HookDurations is how long the start and stop hooks of a cell took
+type HookDurations struct {
+	StartSeconds float64 `json:"start_seconds"`
+	StopSeconds  float64 `json:"stop_seconds,omitempty"`
+}
+
+// TimeHooks times the start and stop hooks appended by the given cells and
+// records them with ObserveHook under the ID of the enclosing module. It
+// cannot wrap the metrics cell itself, which provides Metrics.
+func TimeHooks(cells ...cell.Cell) cell.Cell {
+	return cell.Decorate(
+		func(lc cell.Lifecycle, id cell.ModuleID, m Metrics, logger *slog.Logger) cell.Lifecycle {
+			return &timedLifecycle{Lifecycle: lc, cell: string(id), metrics: m, logger: logger}
+		},
+		cells...,
+	)
+}
+
+// timedLifecycle wraps the hooks appended to it to time them
+type timedLifecycle struct {
+	cell.Lifecycle
+	cell    string
+	metrics Metrics
+	logger  *slog.Logger
+}
+
+func (lc *timedLifecycle) Append(hook cell.HookInterface) {
+	timed := cell.Hook{
+		OnStart: func(ctx cell.HookContext) error {
+			return lc.time(HookStart, func() error { return hook.Start(ctx) })
+		},
+		OnStop: func(ctx cell.HookContext) error {
+			return lc.time(HookStop, func() error { return hook.Stop(ctx) })
+		},
+	}
+	// Keep missing hooks missing, so the hive does not log them as run
+	if h, ok := hook.(cell.Hook); ok {
+		if h.OnStart == nil {
+			timed.OnStart = nil
+		}
+		if h.OnStop == nil {
+			timed.OnStop = nil
+		}
+	}
+	lc.Lifecycle.Append(timed)
+}
+
+// time runs a hook and records how long it took
+func (lc *timedLifecycle) time(phase string, run func() error) error {
+	start := time.Now()
+	err := run()
+	d := time.Since(start)
+
+	lc.metrics.ObserveHook(lc.cell, phase, d)
+	lc.logger.Debug("Hook timed", "cell", lc.cell, "phase", phase, "duration", d, "error", err)
+	return err
+}
+
+func (m *metrics) ObserveHook(cell, phase string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	durations := m.hooks[cell]
+	switch phase {
+	case HookStart:
+		durations.StartSeconds += d.Seconds()
+	case HookStop:
+		durations.StopSeconds += d.Seconds()
+	}
+	m.hooks[cell] = durations
+}
+
+// GetHookDurations returns a snapshot of the hook durations per cell
+func (m *metrics) GetHookDurations() map[string]HookDurations {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.hooks)
+}
+
+// hookFamilies returns the hook durations for exposition, sorted by cell
+func (m *metrics) hookFamilies() []Family {
+	durations := m.GetHookDurations()
+	start := make([]Sample, 0, len(durations))
+	stop := make([]Sample, 0, len(durations))
+	for _, name := range slices.Sorted(maps.Keys(durations)) {
+		labels := []Label{{"cell", name}}
+		start = append(start, Sample{Labels: labels, Value: durations[name].StartSeconds})
+		stop = append(stop, Sample{Labels: labels, Value: durations[name].StopSeconds})
+	}
+
+	return []Family{
+		{
+			Name:    "hook_start_duration_seconds",
+			Help:    "Time taken by the start hooks of each cell",
+			Type:    TypeGauge,
+			Unit:    "seconds",
+			Samples: start,
+		},
+		{
+			Name:    "hook_stop_duration_seconds",
+			Help:    "Time taken by the stop hooks of each cell, 0 until stopped",
+			Type:    TypeGauge,
+			Unit:    "seconds",
+			Samples: stop,
+		},
+	}
+}
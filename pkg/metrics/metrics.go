@@ -2,9 +2,13 @@ package metrics
 
 import (
 	"log/slog"
+	"maps"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/cilium/hive/cell"
+	"github.com/spf13/pflag"
 )
 
 // Cell provides metrics collection
@@ -12,27 +16,136 @@ var Cell = cell.Module(
 	"metrics",
 	"Metrics Collector",
 
+	cell.Config(defaultConfig),
 	cell.Provide(newMetrics),
 )
 
+// Config holds metrics configuration
+type Config struct {
+	GoRuntime      bool `mapstructure:"metrics-go-runtime"`
+	ResetOnScrape  bool `mapstructure:"metrics-reset-on-scrape"`
+	MaxRouteSeries int  `mapstructure:"metrics-max-route-series"`
+}
+
+var defaultConfig = Config{
+	GoRuntime:      true,
+	ResetOnScrape:  false,
+	MaxRouteSeries: 500,
+}
+
+// Flags implements cell.Flagger
+func (c Config) Flags(flags *pflag.FlagSet) {
+	flags.Bool("metrics-go-runtime", c.GoRuntime, "Include Go runtime and process metrics, such as go_goroutines, in /metrics")
+	flags.Bool("metrics-reset-on-scrape", c.ResetOnScrape, "Report the increase of counters and histograms since the previous scrape in /metrics instead of totals")
+	flags.Int("metrics-max-route-series", c.MaxRouteSeries, "Maximum distinct method, route and status combinations counted by http_route_requests_total; further ones are counted as other (0 disables the metric)")
+}
+
+// Error categories recorded by IncrementErrorsByType
+const (
+	ErrorValidation  = "validation"
+	ErrorNotFound    = "not_found"
+	ErrorRateLimited = "rate_limited"
+	ErrorConflict    = "conflict"
+	ErrorForbidden   = "forbidden"
+	ErrorTimeout     = "timeout"
+	ErrorInternal    = "internal"
+	ErrorOther       = "other"
+)
+
 // Metrics provides basic metrics collection
 type Metrics interface {
 	IncrementRequests()
+	// IncrementRouteRequests counts a request by method, route pattern,
+	// such as /tasks/{id}, and status code
+	IncrementRouteRequests(method, route string, status int)
+	// IncrementErrors records an uncategorized error
 	IncrementErrors()
+	// IncrementErrorsByType records an error of the given category, such as
+	// ErrorValidation. It also counts towards the error total.
+	IncrementErrorsByType(kind string)
 	GetRequests() int64
 	GetErrors() int64
+	GetErrorsByType() map[string]int64
+
+	// ObserveQuery records a database query that took d and failed with
+	// err, if not nil
+	ObserveQuery(d time.Duration, err error)
+	GetQueryStats() QueryStats
+
+	// ObserveCacheLookup records a storage cache lookup that hit or missed
+	ObserveCacheLookup(hit bool)
+	GetCacheStats() CacheStats
+
+	// IncrementRejectedJobs records a background job rejected by the
+	// worker pool
+	IncrementRejectedJobs()
+
+	// ObserveHook records that the start or stop hooks of a cell took d,
+	// see TimeHooks
+	ObserveHook(cell, phase string, d time.Duration)
+	GetHookDurations() map[string]HookDurations
+
+	// Pause makes the methods recording requests, errors, queries and
+	// cache lookups do nothing until Resume is called, so a maintenance
+	// window does not show up on dashboards. Hook durations are still
+	// recorded.
+	Pause()
+	Resume()
+	Paused() bool
+
+	// Families returns a snapshot of every metric for exposition, see
+	// WritePrometheus and WriteOpenMetrics. With ResetOnScrape configured,
+	// counters and histograms report the increase since the previous call.
+	Families() []Family
 }
 
 type metrics struct {
+	cfg      Config
 	logger   *slog.Logger
+	created  time.Time
 	requests atomic.Int64
 	errors   atomic.Int64
+	paused   atomic.Bool
+
+	mu     sync.Mutex
+	byType map[string]int64
+	routes map[routeKey]int64
+	hooks  map[string]HookDurations
+	// routesFull is set once the route series limit has been reached
+	routesFull bool
+
+	queries       atomic.Int64
+	queryErrors   atomic.Int64
+	queryDuration *histogram
+
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+
+	rejectedJobs atomic.Int64
+
+	// scrapeMu guards the values reported by the previous scrape and its
+	// time, kept for ResetOnScrape
+	scrapeMu     sync.Mutex
+	lastScrape   map[string]float64
+	lastScrapeAt time.Time
+}
+
+// CacheStats summarizes the storage cache lookups observed so far
+type CacheStats struct {
+	Hits   int64 `json:"hits_total"`
+	Misses int64 `json:"misses_total"`
 }
 
 // newMetrics creates a new metrics collector
-func newMetrics(lc cell.Lifecycle, logger *slog.Logger) Metrics {
+func newMetrics(lc cell.Lifecycle, cfg Config, logger *slog.Logger) Metrics {
 	m := &metrics{
-		logger: logger.With("component", "metrics"),
+		cfg:           cfg,
+		logger:        logger.With("component", "metrics"),
+		created:       time.Now(),
+		byType:        make(map[string]int64),
+		routes:        make(map[routeKey]int64),
+		hooks:         make(map[string]HookDurations),
+		queryDuration: newHistogram(queryBuckets),
 	}
 
 	lc.Append(cell.Hook{
@@ -44,6 +157,7 @@ func newMetrics(lc cell.Lifecycle, logger *slog.Logger) Metrics {
 			m.logger.Info("Metrics summary",
 				"total_requests", m.requests.Load(),
 				"total_errors", m.errors.Load(),
+				"errors_by_type", m.GetErrorsByType(),
 			)
 			return nil
 		},
@@ -53,10 +167,23 @@ func newMetrics(lc cell.Lifecycle, logger *slog.Logger) Metrics {
 }
 
 func (m *metrics) IncrementRequests() {
+	if m.paused.Load() {
+		return
+	}
 	m.requests.Add(1)
 }
 
 func (m *metrics) IncrementErrors() {
+	m.IncrementErrorsByType(ErrorOther)
+}
+
+func (m *metrics) IncrementErrorsByType(kind string) {
+	if m.paused.Load() {
+		return
+	}
+	m.mu.Lock()
+	m.byType[kind]++
+	m.mu.Unlock()
 	m.errors.Add(1)
 }
 
@@ -67,3 +194,70 @@ func (m *metrics) GetRequests() int64 {
 func (m *metrics) GetErrors() int64 {
 	return m.errors.Load()
 }
+
+// GetErrorsByType returns a snapshot of the error counts per category
+func (m *metrics) GetErrorsByType() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.byType)
+}
+
+func (m *metrics) ObserveQuery(d time.Duration, err error) {
+	if m.paused.Load() {
+		return
+	}
+	m.queries.Add(1)
+	if err != nil {
+		m.queryErrors.Add(1)
+	}
+	m.queryDuration.observe(d)
+}
+
+func (m *metrics) GetQueryStats() QueryStats {
+	return QueryStats{
+		Total:    m.queries.Load(),
+		Errors:   m.queryErrors.Load(),
+		Duration: m.queryDuration.snapshot(),
+	}
+}
+
+func (m *metrics) ObserveCacheLookup(hit bool) {
+	if m.paused.Load() {
+		return
+	}
+	if hit {
+		m.cacheHits.Add(1)
+	} else {
+		m.cacheMisses.Add(1)
+	}
+}
+
+func (m *metrics) IncrementRejectedJobs() {
+	if m.paused.Load() {
+		return
+	}
+	m.rejectedJobs.Add(1)
+}
+
+func (m *metrics) GetCacheStats() CacheStats {
+	return CacheStats{
+		Hits:   m.cacheHits.Load(),
+		Misses: m.cacheMisses.Load(),
+	}
+}
+
+func (m *metrics) Pause() {
+	if !m.paused.Swap(true) {
+		m.logger.Warn("Metrics collection paused")
+	}
+}
+
+func (m *metrics) Resume() {
+	if m.paused.Swap(false) {
+		m.logger.Info("Metrics collection resumed")
+	}
+}
+
+func (m *metrics) Paused() bool {
+	return m.paused.Load()
+}
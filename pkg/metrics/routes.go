@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OverflowLabel replaces every label of the requests counted once the
+// route series limit is reached
+const OverflowLabel = "other"
+
+// routeKey is one series of the per-route request counter
+type routeKey struct {
+	method string
+	route  string
+	status string
+}
+
+// IncrementRouteRequests counts a request by method, route pattern and
+// status code. Once MaxRouteSeries distinct series exist, requests that
+// would start a new one are counted in a single series labelled "other"
+// instead, so clients cannot grow the metrics without bound by sending
+// unusual methods or paths.
+func (m *metrics) IncrementRouteRequests(method, route string, status int) {
+	if m.cfg.MaxRouteSeries <= 0 || m.paused.Load() {
+		return
+	}
+	key := routeKey{method: method, route: route, status: strconv.Itoa(status)}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.routes[key]; !ok && len(m.routes) >= m.cfg.MaxRouteSeries {
+		if !m.routesFull {
+			m.routesFull = true
+			m.logger.Warn("Route series limit reached; counting further series as other",
+				"limit", m.cfg.MaxRouteSeries, "method", method, "route", route)
+		}
+		key = routeKey{method: OverflowLabel, route: OverflowLabel, status: OverflowLabel}
+	}
+	m.routes[key]++
+}
+
+// routeSamples returns the per-route request counts, sorted by their labels
+func (m *metrics) routeSamples() []Sample {
+	m.mu.Lock()
+	samples := make([]Sample, 0, len(m.routes))
+	for key, count := range m.routes {
+		samples = append(samples, Sample{
+			Suffix: "_total",
+			Labels: []Label{{"method", key.method}, {"route", key.route}, {"status", key.status}},
+			Value:  float64(count),
+		})
+	}
+	m.mu.Unlock()
+
+	slices.SortFunc(samples, func(a, b Sample) int {
+		for i := range a.Labels {
+			if c := strings.Compare(a.Labels[i].Value, b.Labels[i].Value); c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+	return samples
+}
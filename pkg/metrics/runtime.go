@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processStart approximates when the process started
+var processStart = time.Now()
+
+// userHZ is the unit of the CPU times in /proc/self/stat. It is 100 on all
+// common Linux configurations.
+const userHZ = 100
+
+// runtimeFamilies returns the Go runtime and process metrics. They are named
+// like those of the Prometheus Go client, so existing dashboards work, and
+// their go_ and process_ prefixes keep them apart from the service's own
+// metrics. Process metrics that cannot be read on this platform are left
+// out.
+//
+// The Go client's go_memstats_alloc_bytes_total counter is not included: in
+// OpenMetrics a counter is named without _total, which would clash with the
+// go_memstats_alloc_bytes gauge.
+func runtimeFamilies() []Family {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	families := []Family{
+		gauge("go_goroutines", "Number of goroutines that currently exist", "", float64(runtime.NumGoroutine())),
+		{
+			Name:    "go_info",
+			Help:    "Information about the Go environment",
+			Type:    TypeGauge,
+			Samples: []Sample{{Labels: []Label{{"version", runtime.Version()}}, Value: 1}},
+		},
+		gcDuration(),
+		gauge("go_memstats_alloc_bytes", "Bytes of allocated heap objects", "bytes", float64(ms.Alloc)),
+		gauge("go_memstats_sys_bytes", "Bytes of memory obtained from the OS", "bytes", float64(ms.Sys)),
+		gauge("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects", "bytes", float64(ms.HeapAlloc)),
+		gauge("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans", "bytes", float64(ms.HeapInuse)),
+		gauge("go_memstats_heap_idle_bytes", "Bytes in idle heap spans", "bytes", float64(ms.HeapIdle)),
+		gauge("go_memstats_heap_objects", "Number of allocated heap objects", "", float64(ms.HeapObjects)),
+		gauge("go_memstats_stack_inuse_bytes", "Bytes in stack spans", "bytes", float64(ms.StackInuse)),
+		runtimeCounter("go_memstats_mallocs", "Cumulative count of heap objects allocated", float64(ms.Mallocs)),
+		runtimeCounter("go_memstats_frees", "Cumulative count of heap objects freed", float64(ms.Frees)),
+		gauge("go_memstats_next_gc_bytes", "Heap size target of the next GC cycle", "bytes", float64(ms.NextGC)),
+		gauge("go_memstats_last_gc_time_seconds", "Time the last garbage collection finished, in seconds since the epoch", "seconds",
+			float64(ms.LastGC)/float64(time.Second)),
+		gauge("process_start_time_seconds", "Start time of the process, in seconds since the epoch", "seconds",
+			float64(processStart.UnixNano())/float64(time.Second)),
+	}
+
+	return append(families, procFamilies()...)
+}
+
+func gauge(name, help, unit string, value float64) Family {
+	return Family{
+		Name:    name,
+		Help:    help,
+		Type:    TypeGauge,
+		Unit:    unit,
+		Samples: []Sample{{Value: value}},
+	}
+}
+
+func runtimeCounter(name, help string, value float64) Family {
+	return Family{
+		Name:    name,
+		Help:    help,
+		Type:    TypeCounter,
+		Samples: []Sample{{Suffix: "_total", Value: value}},
+	}
+}
+
+// gcDuration summarizes the garbage collection pauses
+func gcDuration() Family {
+	stats := debug.GCStats{PauseQuantiles: make([]time.Duration, 5)}
+	debug.ReadGCStats(&stats)
+
+	samples := make([]Sample, 0, 7)
+	for i, q := range []string{"0.0", "0.25", "0.5", "0.75", "1.0"} {
+		samples = append(samples, Sample{
+			Labels: []Label{{"quantile", q}},
+			Value:  stats.PauseQuantiles[i].Seconds(),
+		})
+	}
+	samples = append(samples,
+		Sample{Suffix: "_sum", Value: stats.PauseTotal.Seconds()},
+		Sample{Suffix: "_count", Value: float64(stats.NumGC)},
+	)
+
+	return Family{
+		Name:    "go_gc_duration_seconds",
+		Help:    "Pause duration of garbage collection cycles",
+		Type:    TypeSummary,
+		Unit:    "seconds",
+		Samples: samples,
+	}
+}
+
+// procFamilies reads the process metrics from /proc, returning none where it
+// is not available
+func procFamilies() []Family {
+	var families []Family
+
+	if stat, err := os.ReadFile("/proc/self/stat"); err == nil {
+		// Fields after the command name, which may contain spaces; utime
+		// and stime are the 14th and 15th fields of the whole line
+		if i := strings.LastIndexByte(string(stat), ')'); i >= 0 {
+			fields := strings.Fields(string(stat[i+1:]))
+			if len(fields) > 12 {
+				utime, _ := strconv.ParseFloat(fields[11], 64)
+				stime, _ := strconv.ParseFloat(fields[12], 64)
+				families = append(families, Family{
+					Name:    "process_cpu_seconds",
+					Help:    "Total user and system CPU time spent",
+					Type:    TypeCounter,
+					Unit:    "seconds",
+					Samples: []Sample{{Suffix: "_total", Value: (utime + stime) / userHZ}},
+				})
+			}
+		}
+	}
+
+	if statm, err := os.ReadFile("/proc/self/statm"); err == nil {
+		if fields := strings.Fields(string(statm)); len(fields) > 1 {
+			pages, _ := strconv.ParseFloat(fields[1], 64)
+			families = append(families, gauge("process_resident_memory_bytes", "Resident memory size", "bytes",
+				pages*float64(os.Getpagesize())))
+		}
+	}
+
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		families = append(families, gauge("process_open_fds", "Number of open file descriptors", "", float64(len(fds))))
+	}
+
+	return families
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+)
+
+// sinceLastScrape turns the counter and histogram samples of families into
+// the increase since the previous call, for --metrics-reset-on-scrape. The
+// counters themselves keep counting, so /stats and the task manager still
+// see the totals; each scrape instead remembers the values it reported and
+// subtracts them next time. An increment made while a scrape runs is
+// reported by exactly one scrape. Gauges and summaries are left as they are.
+// The caller must hold scrapeMu.
+func (m *metrics) sinceLastScrape(families []Family) []Family {
+	now := time.Now()
+	last := m.lastScrape
+	m.lastScrape = make(map[string]float64, len(last))
+
+	for i := range families {
+		f := &families[i]
+		if f.Type != TypeCounter && f.Type != TypeHistogram {
+			continue
+		}
+		// The series now start at the previous scrape
+		if !f.Created.IsZero() && !m.lastScrapeAt.IsZero() {
+			f.Created = m.lastScrapeAt
+		}
+		for j := range f.Samples {
+			s := &f.Samples[j]
+			key := seriesKey(f.Name, *s)
+			m.lastScrape[key] = s.Value
+			s.Value -= last[key]
+		}
+	}
+
+	m.lastScrapeAt = now
+	return families
+}
+
+// seriesKey identifies a sample across scrapes
+func seriesKey(name string, s Sample) string {
+	var b strings.Builder
+	b.WriteString(name + s.Suffix)
+	for _, l := range s.Labels {
+		b.WriteString("\x00" + l.Name + "=" + l.Value)
+	}
+	return b.String()
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+	"github.com/cilium/hive/cell"
+)
+
+// cacheEntry is a value read from the backend and when it expires
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// cachedStorage wraps a Storage with a read-through cache of Get results.
+// Writes through it invalidate the written key, as do the deletes and
+// evictions the backend reports while running. Writes by other instances
+// sharing the backend are seen once the cached value expires. Expired
+// values are swept every ttl, so keys read once do not stay cached.
+type cachedStorage struct {
+	next    Storage
+	ttl     time.Duration
+	metrics metrics.Metrics
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// generation counts the writes, so a Get that raced with a write does
+	// not cache the value it read before the write
+	generation uint64
+
+	// unsubscribe ends the subscription to the backend's events, which
+	// stops the goroutine following them, and done is closed once it has
+	unsubscribe func()
+	done        chan struct{}
+}
+
+func newCachedStorage(lc cell.Lifecycle, next Storage, ttl time.Duration, m metrics.Metrics) *cachedStorage {
+	s := &cachedStorage{
+		next:    next,
+		ttl:     ttl,
+		metrics: m,
+		entries: make(map[string]cacheEntry),
+	}
+
+	lc.Append(cell.Hook{
+		OnStart: func(ctx cell.HookContext) error {
+			var events <-chan StorageEvent
+			events, s.unsubscribe = next.Subscribe()
+			s.done = make(chan struct{})
+			go s.run(events)
+			return nil
+		},
+		OnStop: func(ctx cell.HookContext) error {
+			s.unsubscribe()
+			<-s.done
+			return nil
+		},
+	})
+
+	return s
+}
+
+// run drops the cached values of the keys the backend deletes or evicts,
+// and sweeps the expired values every ttl, until events is closed. Sets are
+// ignored, as those made through the cache already invalidate the key.
+func (s *cachedStorage) run(events <-chan StorageEvent) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Kind == EventDelete {
+				s.invalidate(event.Key)
+			}
+		case now := <-ticker.C:
+			s.sweep(now)
+		}
+	}
+}
+
+// sweep drops the values that expired before now
+func (s *cachedStorage) sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// invalidate drops the cached value of key. Must be called after the write
+// to the backend, so a concurrent Get cannot cache the old value again.
+func (s *cachedStorage) invalidate(key string) {
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.generation++
+	s.mu.Unlock()
+}
+
+func (s *cachedStorage) Set(ctx context.Context, key string, value interface{}) error {
+	err := s.next.Set(ctx, key, value)
+	s.invalidate(key)
+	return err
+}
+
+func (s *cachedStorage) SetIfAbsent(ctx context.Context, key string, value interface{}) (bool, error) {
+	stored, err := s.next.SetIfAbsent(ctx, key, value)
+	s.invalidate(key)
+	return stored, err
+}
+
+// Get returns the cached value of key if it has not expired, and otherwise
+// reads it from the backend. Missing keys are not cached.
+func (s *cachedStorage) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	if ok && now.After(entry.expires) {
+		delete(s.entries, key)
+		ok = false
+	}
+	generation := s.generation
+	s.mu.Unlock()
+
+	s.metrics.ObserveCacheLookup(ok)
+	if ok {
+		return entry.value, true, nil
+	}
+
+	val, found, err := s.next.Get(ctx, key)
+	if err != nil || !found {
+		return val, found, err
+	}
+
+	s.mu.Lock()
+	if s.generation == generation {
+		s.entries[key] = cacheEntry{value: val, expires: now.Add(s.ttl)}
+	}
+	s.mu.Unlock()
+
+	return val, true, nil
+}
+
+func (s *cachedStorage) Delete(ctx context.Context, key string) error {
+	err := s.next.Delete(ctx, key)
+	s.invalidate(key)
+	return err
+}
+
+func (s *cachedStorage) List(ctx context.Context) (map[string]interface{}, error) {
+	return s.next.List(ctx)
+}
+
+func (s *cachedStorage) Keys(ctx context.Context, prefix string) ([]string, error) {
+	return s.next.Keys(ctx, prefix)
+}
+
+func (s *cachedStorage) Count(ctx context.Context) (int, error) {
+	return s.next.Count(ctx)
+}
+
+func (s *cachedStorage) Clear(ctx context.Context) (int, error) {
+	count, err := s.next.Clear(ctx)
+	s.mu.Lock()
+	s.entries = make(map[string]cacheEntry)
+	s.generation++
+	s.mu.Unlock()
+	return count, err
+}
+
+func (s *cachedStorage) Capacity() int {
+	return s.next.Capacity()
+}
+
+func (s *cachedStorage) Evictions() uint64 {
+	return s.next.Evictions()
+}
+
+func (s *cachedStorage) Subscribe() (<-chan StorageEvent, func()) {
+	return s.next.Subscribe()
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/database"
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+	"github.com/bhargavparmar/hive-demo/pkg/tracing"
+	"github.com/cilium/hive"
+	"github.com/cilium/hive/cell"
+)
+
+// startTestStorage starts the storage cell on the memory backend, with
+// configure adjusting its configuration, and stops it when the test ends
+func startTestStorage(tb testing.TB, configure func(*Config)) Storage {
+	tb.Helper()
+
+	var s Storage
+	h := hive.New(
+		tracing.Cell,
+		database.Cell,
+		metrics.Cell,
+		Cell,
+		cell.Invoke(func(st Storage) { s = st }),
+	)
+	hive.AddConfigOverride(h, func(cfg *Config) {
+		cfg.Backend = BackendMemory
+		configure(cfg)
+	})
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := h.Start(log, context.Background()); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if err := h.Stop(log, context.Background()); err != nil {
+			tb.Error(err)
+		}
+	})
+	return s
+}
+
+// eventually fails the test unless cond holds within a second
+func eventually(tb testing.TB, cond func() bool, msg string) {
+	tb.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			tb.Fatal(msg)
+		}
+	}
+}
+
+func TestCacheDropsEvictedKeys(t *testing.T) {
+	const capacity = 2
+	ctx := context.Background()
+	s := startTestStorage(t, func(cfg *Config) {
+		cfg.MaxItems = capacity
+		cfg.FullBehavior = FullEvict
+		cfg.CacheTTL = time.Hour
+	})
+
+	fill(t, s, capacity)
+	if _, ok, _ := s.Get(ctx, "key-0"); !ok {
+		t.Fatal("key-0 was not stored")
+	}
+
+	// Storing past capacity evicts key-0, which the cache must forget
+	if err := s.Set(ctx, "new", "value"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		_, ok, _ := s.Get(ctx, "key-0")
+		return !ok
+	}, "the cache still returns an evicted key")
+}
+
+func TestCacheSweepsExpiredValues(t *testing.T) {
+	const ttl = 10 * time.Millisecond
+	ctx := context.Background()
+	s := startTestStorage(t, func(cfg *Config) { cfg.CacheTTL = ttl })
+	cache := s.(*tracedStorage).next.(*cachedStorage)
+
+	const keys = 100
+	fill(t, s, keys)
+	for i := range keys {
+		if _, ok, _ := s.Get(ctx, fmt.Sprintf("key-%d", i)); !ok {
+			t.Fatalf("key-%d was not stored", i)
+		}
+	}
+
+	// The keys are never read again, so only the sweep removes them
+	eventually(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return len(cache.entries) == 0
+	}, "expired values are still cached")
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Supported codecs
+const (
+	CodecJSON = "json"
+	CodecGob  = "gob"
+)
+
+// Codec serializes the values stored by backends that keep bytes rather than
+// live objects. The memory backend does not use it.
+type Codec interface {
+	// Name identifies the codec, as selected by --storage-codec
+	Name() string
+	Encode(v interface{}) ([]byte, error)
+	// Decode decodes data into v, which must be a pointer to the type that
+	// was encoded
+	Decode(data []byte, v interface{}) error
+}
+
+// Encoded is a value read from a backend that serializes values, for the
+// caller to decode into the type it stored
+type Encoded struct {
+	Data  []byte
+	Codec Codec
+}
+
+// Decode decodes the value into v
+func (e Encoded) Decode(v interface{}) error {
+	return e.Codec.Decode(e.Data, v)
+}
+
+// newCodec creates the codec selected by the configuration
+func newCodec(cfg Config) (Codec, error) {
+	switch cfg.Codec {
+	case CodecJSON:
+		return jsonCodec{}, nil
+	case CodecGob:
+		return gobCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage codec %q", cfg.Codec)
+	}
+}
+
+// jsonCodec stores values as JSON, readable by other tools
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return CodecJSON }
+
+func (jsonCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// gobCodec stores values with encoding/gob. Each value carries its own type
+// description, so they are only readable from Go.
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return CodecGob }
+
+func (gobCodec) Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Decode(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
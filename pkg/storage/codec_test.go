@@ -0,0 +1,98 @@
+package storage_test
+
+import (
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/storage"
+	"github.com/bhargavparmar/hive-demo/pkg/tasks"
+	"github.com/cilium/hive"
+	"github.com/cilium/hive/cell"
+)
+
+// buildCodec returns the codec the storage cell provides for the name
+func buildCodec(name string) (storage.Codec, error) {
+	var codec storage.Codec
+	h := hive.New(
+		storage.Cell,
+		cell.Invoke(func(c storage.Codec) { codec = c }),
+	)
+	hive.AddConfigOverride(h, func(cfg *storage.Config) { cfg.Codec = name })
+	err := h.Populate(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return codec, err
+}
+
+// fullTask returns a task with every field set
+func fullTask(tb testing.TB) *tasks.Task {
+	tb.Helper()
+	created := time.Date(2024, time.March, 1, 9, 30, 0, 123456789, time.UTC)
+	updated, claimExpires, due := created.Add(time.Hour), created.Add(2*time.Hour), created.Add(24*time.Hour)
+
+	task := &tasks.Task{
+		ID:              "task-1",
+		Title:           "Deploy",
+		Description:     "Roll out the release",
+		Status:          tasks.StatusInProgress,
+		Assignee:        "alice",
+		Archived:        true,
+		Starred:         true,
+		CreatedAt:       created,
+		UpdatedAt:       updated,
+		Labels:          map[string]string{"team": "payments", "env": "prod"},
+		EstimateMinutes: 90,
+		SpentMinutes:    45,
+		Order:           2.5,
+		Watchers:        []string{"bob", "carol"},
+		WatcherCount:    2,
+		ClaimedBy:       "worker-1",
+		ClaimExpiresAt:  &claimExpires,
+		DueAt:           &due,
+	}
+
+	// A field added to Task must be set here to be covered
+	v := reflect.ValueOf(task).Elem()
+	for i := range v.NumField() {
+		if v.Field(i).IsZero() {
+			tb.Fatalf("fullTask does not set %s", v.Type().Field(i).Name)
+		}
+	}
+	return task
+}
+
+func TestCodecsRoundTripTasks(t *testing.T) {
+	for _, name := range []string{storage.CodecJSON, storage.CodecGob} {
+		t.Run(name, func(t *testing.T) {
+			codec, err := buildCodec(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if codec.Name() != name {
+				t.Fatalf("got codec %s, want %s", codec.Name(), name)
+			}
+
+			task := fullTask(t)
+			data, err := codec.Encode(task)
+			if err != nil {
+				t.Fatalf("encoding: %v", err)
+			}
+			var decoded tasks.Task
+			if err := (storage.Encoded{Data: data, Codec: codec}).Decode(&decoded); err != nil {
+				t.Fatalf("decoding: %v", err)
+			}
+			if !reflect.DeepEqual(&decoded, task) {
+				t.Fatalf("got %+v, want %+v", decoded, *task)
+			}
+		})
+	}
+}
+
+func TestUnknownCodecRejected(t *testing.T) {
+	_, err := buildCodec("xml")
+	if err == nil || !strings.Contains(err.Error(), `unknown storage codec "xml"`) {
+		t.Fatalf("got error %v, want the unknown codec rejected", err)
+	}
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Kinds of storage events
+const (
+	EventSet    = "set"
+	EventDelete = "delete"
+)
+
+// subscriberBuffer is the number of events buffered for each subscriber.
+// Events that do not fit are dropped for that subscriber.
+const subscriberBuffer = 256
+
+// StorageEvent describes a change to one key. Value is the stored value for
+// EventSet, in the form Get would return it, and nil for EventDelete.
+type StorageEvent struct {
+	Kind  string
+	Key   string
+	Value interface{}
+}
+
+// broadcaster fans storage events out to subscribers without blocking the
+// writer
+type broadcaster struct {
+	logger *slog.Logger
+
+	mu   sync.Mutex
+	subs map[chan StorageEvent]struct{}
+}
+
+// Subscribe returns a channel of events and the function that unsubscribes
+// and closes it
+func (b *broadcaster) Subscribe() (<-chan StorageEvent, func()) {
+	ch := make(chan StorageEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[chan StorageEvent]struct{})
+	}
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			close(ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// publish sends an event to every subscriber with room for it
+func (b *broadcaster) publish(event StorageEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			b.logger.Warn("Storage event dropped for slow subscriber", "kind", event.Kind, "key", event.Key)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bhargavparmar/hive-demo/pkg/database"
+	"github.com/cilium/hive/cell"
+)
+
+type memoryStorage struct {
+	broadcaster
+
+	logger       *slog.Logger
+	db           database.Database
+	maxItems     int
+	fullBehavior string
+
+	mu   sync.RWMutex
+	data map[string]interface{}
+	// order holds the keys from oldest to newest insertion, and elems
+	// indexes it by key, so that the oldest item can be evicted
+	order *list.List
+	elems map[string]*list.Element
+
+	evictions atomic.Uint64
+}
+
+// newMemoryStorage creates a new in-memory storage with database dependency
+func newMemoryStorage(lc cell.Lifecycle, cfg Config, logger *slog.Logger, db database.Database) *memoryStorage {
+	s := &memoryStorage{
+		logger:       logger.With("component", "storage"),
+		db:           db,
+		maxItems:     cfg.MaxItems,
+		fullBehavior: cfg.FullBehavior,
+		data:         make(map[string]interface{}),
+		order:        list.New(),
+		elems:        make(map[string]*list.Element),
+	}
+	s.broadcaster.logger = s.logger
+
+	lc.Append(cell.Hook{
+		OnStart: func(ctx cell.HookContext) error {
+			s.logger.Info("Initializing storage...")
+			// Verify database is ready
+			if !s.db.IsConnected() {
+				s.logger.Warn("Database not connected, storage may have limited functionality")
+			}
+			if s.maxItems > 0 {
+				s.logger.Info("Storage initialized", "capacity", s.maxItems, "full_behavior", s.fullBehavior)
+			} else {
+				s.logger.Info("Storage initialized", "capacity", "unlimited")
+			}
+			return nil
+		},
+		OnStop: func(ctx cell.HookContext) error {
+			s.logger.Info("Clearing storage...")
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			count := len(s.data)
+			s.data = make(map[string]interface{})
+			s.order.Init()
+			s.elems = make(map[string]*list.Element)
+			s.logger.Info("Storage cleared", "items_removed", count)
+			return nil
+		},
+	})
+
+	return s
+}
+
+func (s *memoryStorage) Set(ctx context.Context, key string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.data[key]; !exists {
+		if err := s.makeRoom(); err != nil {
+			return err
+		}
+		s.elems[key] = s.order.PushBack(key)
+	}
+	s.data[key] = value
+	s.publish(StorageEvent{Kind: EventSet, Key: key, Value: value})
+	s.logger.Debug("Item stored", "key", key)
+	return nil
+}
+
+// makeRoom ensures there is space for a new key, either by evicting the
+// oldest item or by failing with ErrFull. Must be called with mu held.
+func (s *memoryStorage) makeRoom() error {
+	if s.maxItems <= 0 || len(s.data) < s.maxItems {
+		return nil
+	}
+
+	if s.fullBehavior == FullReject {
+		return ErrFull
+	}
+
+	oldest := s.order.Front().Value.(string)
+	s.remove(oldest)
+	s.evictions.Add(1)
+	s.logger.Warn("Storage full, evicted oldest item", "key", oldest, "capacity", s.maxItems)
+	return nil
+}
+
+// remove deletes a key and its insertion order entry, publishing an event
+// if the key existed. Must be called with mu held.
+func (s *memoryStorage) remove(key string) {
+	if elem, ok := s.elems[key]; ok {
+		s.order.Remove(elem)
+		delete(s.elems, key)
+	}
+	if _, ok := s.data[key]; ok {
+		delete(s.data, key)
+		s.publish(StorageEvent{Kind: EventDelete, Key: key})
+	}
+}
+
+// SetIfAbsent stores the value only if the key is not already present and
+// reports whether it was stored
+func (s *memoryStorage) SetIfAbsent(ctx context.Context, key string, value interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.data[key]; exists {
+		return false, nil
+	}
+	if err := s.makeRoom(); err != nil {
+		return false, err
+	}
+	s.elems[key] = s.order.PushBack(key)
+	s.data[key] = value
+	s.publish(StorageEvent{Kind: EventSet, Key: key, Value: value})
+	s.logger.Debug("Item stored", "key", key)
+	return true, nil
+}
+
+func (s *memoryStorage) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	val, ok := s.data[key]
+	return val, ok, nil
+}
+
+func (s *memoryStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	s.logger.Debug("Item deleted", "key", key)
+	return nil
+}
+
+// List copies the whole store, so it checks for cancellation first
+func (s *memoryStorage) List(ctx context.Context) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]interface{}, len(s.data))
+	for k, v := range s.data {
+		result[k] = v
+	}
+	return result, nil
+}
+
+func (s *memoryStorage) Keys(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0)
+	for k := range s.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memoryStorage) Count(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data), nil
+}
+
+// Clear empties the store in one critical section, so no write is
+// interleaved with it
+func (s *memoryStorage) Clear(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := len(s.data)
+	for key := range s.data {
+		s.publish(StorageEvent{Kind: EventDelete, Key: key})
+	}
+	s.data = make(map[string]interface{})
+	s.order.Init()
+	s.elems = make(map[string]*list.Element)
+	return count, nil
+}
+
+func (s *memoryStorage) Capacity() int {
+	return s.maxItems
+}
+
+func (s *memoryStorage) Evictions() uint64 {
+	return s.evictions.Load()
+}
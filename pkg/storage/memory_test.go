@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/cilium/hive/cell"
+)
+
+// newTestMemory returns a memory backend holding at most maxItems, doing
+// fullBehavior when full
+func newTestMemory(maxItems int, fullBehavior string) *memoryStorage {
+	cfg := defaultConfig
+	cfg.MaxItems = maxItems
+	cfg.FullBehavior = fullBehavior
+	return newMemoryStorage(&cell.DefaultLifecycle{}, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+}
+
+// fill stores the keys key-0 to key-(n-1) in that order
+func fill(tb testing.TB, s Storage, n int) {
+	tb.Helper()
+	for i := range n {
+		if err := s.Set(context.Background(), fmt.Sprintf("key-%d", i), i); err != nil {
+			tb.Fatalf("storing key-%d: %v", i, err)
+		}
+	}
+}
+
+func TestMemoryCapacity(t *testing.T) {
+	const capacity = 5
+	ctx := context.Background()
+
+	for _, behavior := range []string{FullEvict, FullReject} {
+		t.Run(behavior, func(t *testing.T) {
+			s := newTestMemory(capacity, behavior)
+
+			// Up to the capacity every key fits
+			fill(t, s, capacity-1)
+			if err := s.Set(ctx, "last", "fits"); err != nil {
+				t.Fatalf("storing the item that reaches capacity: %v", err)
+			}
+			if count, _ := s.Count(ctx); count != capacity {
+				t.Fatalf("got %d items, want %d", count, capacity)
+			}
+
+			// Replacing a stored key needs no room
+			if err := s.Set(ctx, "last", "replaced"); err != nil {
+				t.Fatalf("replacing a key at capacity: %v", err)
+			}
+		})
+	}
+}
+
+func TestMemoryEvictsOldest(t *testing.T) {
+	const capacity = 3
+	ctx := context.Background()
+	s := newTestMemory(capacity, FullEvict)
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	fill(t, s, capacity)
+	// Replacing does not make a key newer
+	if err := s.Set(ctx, "key-0", "replaced"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(ctx, "new", "value"); err != nil {
+		t.Fatalf("storing past capacity: %v", err)
+	}
+
+	if _, ok, _ := s.Get(ctx, "key-0"); ok {
+		t.Fatal("the oldest key was not evicted")
+	}
+	for _, key := range []string{"key-1", "key-2", "new"} {
+		if _, ok, _ := s.Get(ctx, key); !ok {
+			t.Fatalf("%s was evicted instead of the oldest key", key)
+		}
+	}
+	if count, _ := s.Count(ctx); count != capacity {
+		t.Fatalf("got %d items, want %d", count, capacity)
+	}
+
+	// The eviction is published like a delete, before the new key is set
+	var got []StorageEvent
+	for range capacity + 3 {
+		got = append(got, <-events)
+	}
+	want := StorageEvent{Kind: EventDelete, Key: "key-0"}
+	if got[capacity+1] != want {
+		t.Fatalf("got events %v, want %v before the new key", got, want)
+	}
+}
+
+func TestMemoryRejectsWhenFull(t *testing.T) {
+	const capacity = 3
+	ctx := context.Background()
+	s := newTestMemory(capacity, FullReject)
+	fill(t, s, capacity)
+
+	if err := s.Set(ctx, "new", "value"); !errors.Is(err, ErrFull) {
+		t.Fatalf("Set past capacity: got error %v, want %v", err, ErrFull)
+	}
+	if stored, err := s.SetIfAbsent(ctx, "new", "value"); stored || !errors.Is(err, ErrFull) {
+		t.Fatalf("SetIfAbsent past capacity: got %v and error %v, want %v", stored, err, ErrFull)
+	}
+	if _, ok, _ := s.Get(ctx, "new"); ok {
+		t.Fatal("a rejected key was stored")
+	}
+	for i := range capacity {
+		if _, ok, _ := s.Get(ctx, fmt.Sprintf("key-%d", i)); !ok {
+			t.Fatalf("key-%d was removed by a rejected write", i)
+		}
+	}
+
+	// Deleting makes room again
+	if err := s.Delete(ctx, "key-0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(ctx, "new", "value"); err != nil {
+		t.Fatalf("storing after a delete: %v", err)
+	}
+}
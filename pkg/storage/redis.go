@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/cilium/hive/cell"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisScanCount is the number of keys requested per SCAN iteration
+const redisScanCount = 100
+
+// redisStorage stores values encoded by the codec in Redis under a common
+// key prefix. Values read back are returned as Encoded for the caller to
+// decode.
+type redisStorage struct {
+	broadcaster
+
+	logger *slog.Logger
+	client *redis.Client
+	prefix string
+	codec  Codec
+}
+
+// newRedisStorage creates a Redis-backed storage that connects on start
+func newRedisStorage(lc cell.Lifecycle, cfg Config, logger *slog.Logger, codec Codec) *redisStorage {
+	s := &redisStorage{
+		logger: logger.With("component", "storage", "backend", BackendRedis, "codec", codec.Name()),
+		prefix: cfg.RedisKeyPrefix,
+		codec:  codec,
+	}
+	s.broadcaster.logger = s.logger
+
+	lc.Append(cell.Hook{
+		OnStart: func(ctx cell.HookContext) error {
+			s.logger.Info("Connecting to Redis...", "addr", cfg.RedisAddr, "db", cfg.RedisDB)
+			s.client = redis.NewClient(&redis.Options{
+				Addr: cfg.RedisAddr,
+				DB:   cfg.RedisDB,
+			})
+			if err := s.client.Ping(ctx).Err(); err != nil {
+				s.client.Close()
+				return fmt.Errorf("connecting to redis at %s: %w", cfg.RedisAddr, err)
+			}
+			s.logger.Info("Storage initialized")
+			return nil
+		},
+		OnStop: func(ctx cell.HookContext) error {
+			s.logger.Info("Closing Redis connection...")
+			return s.client.Close()
+		},
+	})
+
+	return s
+}
+
+func (s *redisStorage) Set(ctx context.Context, key string, value interface{}) error {
+	data, err := s.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Set(ctx, s.prefix+key, data, 0).Err(); err != nil {
+		return err
+	}
+	s.publish(StorageEvent{Kind: EventSet, Key: key, Value: s.encoded(data)})
+	s.logger.Debug("Item stored", "key", key)
+	return nil
+}
+
+func (s *redisStorage) SetIfAbsent(ctx context.Context, key string, value interface{}) (bool, error) {
+	data, err := s.codec.Encode(value)
+	if err != nil {
+		return false, err
+	}
+	stored, err := s.client.SetNX(ctx, s.prefix+key, data, 0).Result()
+	if err != nil {
+		return false, err
+	}
+	if stored {
+		s.publish(StorageEvent{Kind: EventSet, Key: key, Value: s.encoded(data)})
+		s.logger.Debug("Item stored", "key", key)
+	}
+	return stored, nil
+}
+
+func (s *redisStorage) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return s.encoded(data), true, nil
+}
+
+// encoded wraps data read from or written to Redis for decoding
+func (s *redisStorage) encoded(data []byte) Encoded {
+	return Encoded{Data: data, Codec: s.codec}
+}
+
+func (s *redisStorage) Delete(ctx context.Context, key string) error {
+	deleted, err := s.client.Del(ctx, s.prefix+key).Result()
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		s.publish(StorageEvent{Kind: EventDelete, Key: key})
+	}
+	s.logger.Debug("Item deleted", "key", key)
+	return nil
+}
+
+// List scans for all keys under the prefix and fetches them in batches.
+// Keys deleted between the scan and the fetch are skipped.
+func (s *redisStorage) List(ctx context.Context) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	iter := s.client.Scan(ctx, 0, escapeGlob(s.prefix)+"*", redisScanCount).Iterator()
+	batch := make([]string, 0, redisScanCount)
+
+	fetch := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		values, err := s.client.MGet(ctx, batch...).Result()
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			if str, ok := v.(string); ok {
+				result[strings.TrimPrefix(batch[i], s.prefix)] = s.encoded([]byte(str))
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == cap(batch) {
+			if err := fetch(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	if err := fetch(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *redisStorage) Keys(ctx context.Context, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	iter := s.client.Scan(ctx, 0, escapeGlob(s.prefix+prefix)+"*", redisScanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), s.prefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// escapeGlob escapes the characters that SCAN MATCH treats as patterns
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Count scans the keys under the prefix, so it is O(n) in the number of keys
+func (s *redisStorage) Count(ctx context.Context) (int, error) {
+	count := 0
+	iter := s.client.Scan(ctx, 0, escapeGlob(s.prefix)+"*", redisScanCount).Iterator()
+	for iter.Next(ctx) {
+		count++
+	}
+	return count, iter.Err()
+}
+
+// Clear scans for the keys under the prefix and deletes them in batches.
+// Unlike the memory backend it is not atomic: keys written during the scan
+// may survive it.
+func (s *redisStorage) Clear(ctx context.Context) (int, error) {
+	count := 0
+	iter := s.client.Scan(ctx, 0, escapeGlob(s.prefix)+"*", redisScanCount).Iterator()
+	batch := make([]string, 0, redisScanCount)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		deleted, err := s.client.Del(ctx, batch...).Result()
+		if err != nil {
+			return err
+		}
+		count += int(deleted)
+		for _, key := range batch {
+			s.publish(StorageEvent{Kind: EventDelete, Key: strings.TrimPrefix(key, s.prefix)})
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == cap(batch) {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return count, err
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
+
+// Capacity is always 0, as Redis memory limits are enforced by the server
+func (s *redisStorage) Capacity() int {
+	return 0
+}
+
+// Evictions is always 0, as keys evicted by the Redis server are not
+// reported
+func (s *redisStorage) Evictions() uint64 {
+	return 0
+}
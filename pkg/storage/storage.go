@@ -1,103 +1,140 @@
 package storage
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
-	"sync"
+	"time"
 
 	"github.com/bhargavparmar/hive-demo/pkg/database"
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
 	"github.com/cilium/hive/cell"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Cell provides in-memory storage
+// Cell provides key-value storage using the configured backend
 var Cell = cell.Module(
 	"storage",
-	"In-Memory Storage",
+	"Key-Value Storage",
 
-	cell.Provide(newStorage),
+	cell.Config(defaultConfig),
+	metrics.TimeHooks(
+		cell.Provide(newCodec, newStorage),
+	),
 )
 
-// Storage provides thread-safe in-memory storage
-type Storage interface {
-	Set(key string, value interface{})
-	Get(key string) (interface{}, bool)
-	Delete(key string)
-	List() map[string]interface{}
-	Count() int
-}
-
-type memoryStorage struct {
-	logger *slog.Logger
-	db     database.Database
-	mu     sync.RWMutex
-	data   map[string]interface{}
-}
+// Supported storage backends
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
 
-// newStorage creates a new in-memory storage with database dependency
-func newStorage(lc cell.Lifecycle, logger *slog.Logger, db database.Database) Storage {
-	s := &memoryStorage{
-		logger: logger.With("component", "storage"),
-		db:     db,
-		data:   make(map[string]interface{}),
-	}
+// Behaviors when a bounded storage is full
+const (
+	FullEvict  = "evict"
+	FullReject = "reject"
+)
 
-	lc.Append(cell.Hook{
-		OnStart: func(ctx cell.HookContext) error {
-			s.logger.Info("Initializing storage...")
-			// Verify database is ready
-			if !s.db.IsConnected() {
-				s.logger.Warn("Database not connected, storage may have limited functionality")
-			}
-			s.logger.Info("Storage initialized", "capacity", "unlimited")
-			return nil
-		},
-		OnStop: func(ctx cell.HookContext) error {
-			s.logger.Info("Clearing storage...")
-			s.mu.Lock()
-			defer s.mu.Unlock()
-			count := len(s.data)
-			s.data = make(map[string]interface{})
-			s.logger.Info("Storage cleared", "items_removed", count)
-			return nil
-		},
-	})
+// ErrFull is returned when storing a new key in a full storage configured
+// to reject writes
+var ErrFull = errors.New("storage is full")
 
-	return s
+// Config holds storage configuration
+type Config struct {
+	Backend        string        `mapstructure:"storage-backend"`
+	Codec          string        `mapstructure:"storage-codec"`
+	MaxItems       int           `mapstructure:"storage-max-items"`
+	FullBehavior   string        `mapstructure:"storage-full-behavior"`
+	RedisAddr      string        `mapstructure:"redis-addr"`
+	RedisDB        int           `mapstructure:"redis-db"`
+	RedisKeyPrefix string        `mapstructure:"redis-key-prefix"`
+	CacheTTL       time.Duration `mapstructure:"storage-cache-ttl"`
 }
 
-func (s *memoryStorage) Set(key string, value interface{}) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.data[key] = value
-	s.logger.Debug("Item stored", "key", key)
+var defaultConfig = Config{
+	Backend:        BackendMemory,
+	Codec:          CodecJSON,
+	MaxItems:       0,
+	FullBehavior:   FullEvict,
+	RedisAddr:      "localhost:6379",
+	RedisDB:        0,
+	RedisKeyPrefix: "task-manager:",
+	CacheTTL:       0,
 }
 
-func (s *memoryStorage) Get(key string) (interface{}, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	val, ok := s.data[key]
-	return val, ok
+// Flags implements cell.Flagger
+func (c Config) Flags(flags *pflag.FlagSet) {
+	flags.String("storage-backend", c.Backend, "Storage backend (memory, redis)")
+	flags.String("storage-codec", c.Codec, "How the redis backend serializes values (json, gob). Values written with another codec cannot be read")
+	flags.Int("storage-max-items", c.MaxItems, "Maximum number of items in the memory backend (0 for unlimited)")
+	flags.String("storage-full-behavior", c.FullBehavior, "What the memory backend does when full: evict the oldest item or reject the write (evict, reject)")
+	flags.String("redis-addr", c.RedisAddr, "Redis server address for the redis storage backend")
+	flags.Int("redis-db", c.RedisDB, "Redis database number for the redis storage backend")
+	flags.String("redis-key-prefix", c.RedisKeyPrefix, "Prefix for keys written by the redis storage backend")
+	flags.Duration("storage-cache-ttl", c.CacheTTL, "How long values read from the storage backend are cached in memory (0 disables the cache)")
 }
 
-func (s *memoryStorage) Delete(key string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.data, key)
-	s.logger.Debug("Item deleted", "key", key)
+// Storage provides thread-safe key-value storage. Every operation takes a
+// context so that backends can abandon work for cancelled requests.
+//
+// The memory backend returns the stored values as-is. Backends that
+// serialize values return them as Encoded instead.
+type Storage interface {
+	Set(ctx context.Context, key string, value interface{}) error
+	SetIfAbsent(ctx context.Context, key string, value interface{}) (bool, error)
+	Get(ctx context.Context, key string) (interface{}, bool, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context) (map[string]interface{}, error)
+	// Keys returns the keys starting with prefix. The result is a snapshot
+	// taken at call time, in no particular order.
+	Keys(ctx context.Context, prefix string) ([]string, error)
+	Count(ctx context.Context) (int, error)
+	// Clear removes every item and returns how many were removed. A delete
+	// event is published for each of them.
+	Clear(ctx context.Context) (int, error)
+	// Capacity returns the maximum number of items the storage holds, or 0
+	// if it is unbounded
+	Capacity() int
+	// Evictions returns how many items the storage has removed to make
+	// room for others since it was created, so that callers keeping their
+	// own tally of the stored items can tell when it went out of date
+	Evictions() uint64
+	// Subscribe returns a channel that receives an event for every
+	// successful write, including evictions, and the function that ends the
+	// subscription and closes the channel. Writers never wait for
+	// subscribers: events that do not fit a subscriber's buffer are
+	// dropped for it. The redis backend only reports writes made through
+	// this instance.
+	Subscribe() (<-chan StorageEvent, func())
 }
 
-func (s *memoryStorage) List() map[string]interface{} {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// newStorage creates the storage backend selected by the configuration
+func newStorage(lc cell.Lifecycle, cfg Config, logger *slog.Logger, db database.Database, m metrics.Metrics, tp trace.TracerProvider, codec Codec) (Storage, error) {
+	if cfg.MaxItems < 0 {
+		return nil, fmt.Errorf("storage-max-items must not be negative, got %d", cfg.MaxItems)
+	}
+	if cfg.FullBehavior != FullEvict && cfg.FullBehavior != FullReject {
+		return nil, fmt.Errorf("unknown storage full behavior %q", cfg.FullBehavior)
+	}
+	if cfg.CacheTTL < 0 {
+		return nil, fmt.Errorf("storage-cache-ttl must not be negative, got %v", cfg.CacheTTL)
+	}
 
-	result := make(map[string]interface{}, len(s.data))
-	for k, v := range s.data {
-		result[k] = v
+	var backend Storage
+	switch cfg.Backend {
+	case BackendMemory:
+		backend = newMemoryStorage(lc, cfg, logger, db)
+	case BackendRedis:
+		backend = newRedisStorage(lc, cfg, logger, codec)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+
+	if cfg.CacheTTL > 0 {
+		backend = newCachedStorage(lc, backend, cfg.CacheTTL, m)
 	}
-	return result
-}
 
-func (s *memoryStorage) Count() int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return len(s.data)
+	return &tracedStorage{next: backend, tracer: tp.Tracer("storage")}, nil
 }
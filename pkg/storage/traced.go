@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedStorage wraps a Storage with a span around every operation
+type tracedStorage struct {
+	next   Storage
+	tracer trace.Tracer
+}
+
+func (s *tracedStorage) start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "storage."+op, trace.WithAttributes(attrs...))
+}
+
+// end records err on the span, if any, and ends it
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (s *tracedStorage) Set(ctx context.Context, key string, value interface{}) error {
+	ctx, span := s.start(ctx, "Set", attribute.String("storage.key", key))
+	err := s.next.Set(ctx, key, value)
+	end(span, err)
+	return err
+}
+
+func (s *tracedStorage) SetIfAbsent(ctx context.Context, key string, value interface{}) (bool, error) {
+	ctx, span := s.start(ctx, "SetIfAbsent", attribute.String("storage.key", key))
+	stored, err := s.next.SetIfAbsent(ctx, key, value)
+	span.SetAttributes(attribute.Bool("storage.stored", stored))
+	end(span, err)
+	return stored, err
+}
+
+func (s *tracedStorage) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	ctx, span := s.start(ctx, "Get", attribute.String("storage.key", key))
+	val, ok, err := s.next.Get(ctx, key)
+	span.SetAttributes(attribute.Bool("storage.found", ok))
+	end(span, err)
+	return val, ok, err
+}
+
+func (s *tracedStorage) Delete(ctx context.Context, key string) error {
+	ctx, span := s.start(ctx, "Delete", attribute.String("storage.key", key))
+	err := s.next.Delete(ctx, key)
+	end(span, err)
+	return err
+}
+
+func (s *tracedStorage) List(ctx context.Context) (map[string]interface{}, error) {
+	ctx, span := s.start(ctx, "List")
+	items, err := s.next.List(ctx)
+	span.SetAttributes(attribute.Int("storage.items", len(items)))
+	end(span, err)
+	return items, err
+}
+
+func (s *tracedStorage) Keys(ctx context.Context, prefix string) ([]string, error) {
+	ctx, span := s.start(ctx, "Keys", attribute.String("storage.prefix", prefix))
+	keys, err := s.next.Keys(ctx, prefix)
+	span.SetAttributes(attribute.Int("storage.items", len(keys)))
+	end(span, err)
+	return keys, err
+}
+
+func (s *tracedStorage) Count(ctx context.Context) (int, error) {
+	ctx, span := s.start(ctx, "Count")
+	count, err := s.next.Count(ctx)
+	end(span, err)
+	return count, err
+}
+
+func (s *tracedStorage) Clear(ctx context.Context) (int, error) {
+	ctx, span := s.start(ctx, "Clear")
+	count, err := s.next.Clear(ctx)
+	span.SetAttributes(attribute.Int("storage.items", count))
+	end(span, err)
+	return count, err
+}
+
+func (s *tracedStorage) Capacity() int {
+	return s.next.Capacity()
+}
+
+func (s *tracedStorage) Evictions() uint64 {
+	return s.next.Evictions()
+}
+
+func (s *tracedStorage) Subscribe() (<-chan StorageEvent, func()) {
+	return s.next.Subscribe()
+}
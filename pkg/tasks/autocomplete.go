@@ -0,0 +1,117 @@
+package tasks
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+)
+
+// MaxAutocompleteLimit is the most suggestions Autocomplete returns
+const MaxAutocompleteLimit = 100
+
+// ErrInvalidAutocomplete is returned for an empty query or a limit out of
+// range
+var ErrInvalidAutocomplete = errors.New("invalid autocomplete query")
+
+// Kinds of autocomplete matches, best first
+const (
+	matchPrefix = iota
+	matchWordPrefix
+	matchFuzzy
+)
+
+// suggestion is a title matching an autocomplete query
+type suggestion struct {
+	title string
+	kind  int
+}
+
+// Autocomplete suggests the titles of unarchived tasks for a query,
+// ignoring case. Titles starting with the query come first, then titles
+// with a word starting with it, then titles containing its characters in
+// order. Each group is sorted alphabetically. Titles that differ only in
+// case are listed once, as written in the oldest task.
+//
+// The tasks are scanned on every call rather than indexed, since with a
+// shared backend the index would miss other instances' writes.
+func (tm *taskManager) Autocomplete(ctx context.Context, query string, limit int) ([]string, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Autocomplete")
+	defer span.End()
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	switch {
+	case query == "":
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, fmt.Errorf("%w: query is required", ErrInvalidAutocomplete)
+	case limit < 1 || limit > MaxAutocompleteLimit:
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d, got %d", ErrInvalidAutocomplete, MaxAutocompleteLimit, limit)
+	}
+
+	list, err := tm.List(ctx, Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var matches []suggestion
+	for _, task := range list {
+		title := strings.ToLower(task.Title)
+		if seen[title] {
+			continue
+		}
+		if kind, ok := matchTitle(title, query); ok {
+			seen[title] = true
+			matches = append(matches, suggestion{title: task.Title, kind: kind})
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b suggestion) int {
+		return cmp.Or(
+			cmp.Compare(a.kind, b.kind),
+			cmp.Compare(strings.ToLower(a.title), strings.ToLower(b.title)),
+		)
+	})
+
+	titles := make([]string, 0, min(limit, len(matches)))
+	for _, m := range matches[:min(limit, len(matches))] {
+		titles = append(titles, m.title)
+	}
+	return titles, nil
+}
+
+// matchTitle reports how a lowercase title matches a lowercase query
+func matchTitle(title, query string) (int, bool) {
+	if strings.HasPrefix(title, query) {
+		return matchPrefix, true
+	}
+
+	words := strings.FieldsFunc(title, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if strings.HasPrefix(word, query) {
+			return matchWordPrefix, true
+		}
+	}
+
+	// Every character of the query, in order
+	rest := query
+	for _, r := range title {
+		next, size := utf8.DecodeRuneInString(rest)
+		if r == next {
+			rest = rest[size:]
+			if rest == "" {
+				return matchFuzzy, true
+			}
+		}
+	}
+	return 0, false
+}
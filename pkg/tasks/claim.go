@@ -0,0 +1,148 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Limits on claims
+const (
+	MaxClaimTTL       = 24 * time.Hour
+	MaxWorkerIDLength = 128
+)
+
+var (
+	// ErrInvalidClaim is returned for a malformed worker ID or a claim
+	// duration out of range
+	ErrInvalidClaim = errors.New("invalid claim")
+	// ErrClaimHeld is returned when releasing a task claimed by another
+	// worker whose claim has not expired. Claim reports such a task as not
+	// claimed instead, which the API answers with ErrClaimHeld too.
+	ErrClaimHeld = errors.New("task is claimed by another worker")
+)
+
+// validateWorkerID checks that a worker ID is 1 to MaxWorkerIDLength ASCII
+// letters, digits, '-', '_', '.' and ':', enough for host names and ports
+func validateWorkerID(worker string) error {
+	switch {
+	case worker == "":
+		return fmt.Errorf("%w: worker must not be empty", ErrInvalidClaim)
+	case len(worker) > MaxWorkerIDLength:
+		return fmt.Errorf("%w: worker must be at most %d characters", ErrInvalidClaim, MaxWorkerIDLength)
+	}
+
+	for _, r := range worker {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return fmt.Errorf("%w: worker %q may only contain letters, digits, '-', '_', '.' and ':'", ErrInvalidClaim, worker)
+		}
+	}
+	return nil
+}
+
+// claimedBy returns the worker holding an unexpired claim on the task at
+// now, or "" if there is none
+func (t *Task) claimedBy(now time.Time) string {
+	if t.ClaimExpiresAt == nil || !now.Before(*t.ClaimExpiresAt) {
+		return ""
+	}
+	return t.ClaimedBy
+}
+
+// Claim gives worker the task for ttl, unless another worker holds an
+// unexpired claim on it, in which case it returns false. A worker claiming
+// a task it already holds extends the claim. Claims are checked and set
+// under the task's lock, so two workers never both succeed.
+func (tm *taskManager) Claim(ctx context.Context, id, worker string, ttl time.Duration) (bool, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Claim")
+	defer span.End()
+
+	if err := validateWorkerID(worker); err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return false, err
+	}
+	if ttl <= 0 || ttl > MaxClaimTTL {
+		err := fmt.Errorf("%w: duration must be positive and at most %s, got %s", ErrInvalidClaim, MaxClaimTTL, ttl)
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return false, err
+	}
+
+	defer tm.locks.lock(id)()
+
+	current, err := tm.Get(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	now := tm.clock.Now()
+	if holder := current.claimedBy(now); holder != "" && holder != worker {
+		return false, nil
+	}
+
+	task := *current
+	expires := now.Add(ttl)
+	task.ClaimedBy = worker
+	task.ClaimExpiresAt = &expires
+	task.UpdatedAt = now
+
+	if err := tm.storage.Set(ctx, id, &task); err != nil {
+		return false, err
+	}
+	tm.stats.replace(current, &task)
+	tm.version.Add(1)
+	tm.logger.Info("Task claimed", "id", id, "worker", worker, "expires_at", expires)
+	tm.hooks.Publish(EventUpdated, &task)
+
+	return true, nil
+}
+
+// Release gives up worker's claim on a task. Releasing a task that is not
+// claimed has no effect, and any worker may clear a claim that has expired.
+func (tm *taskManager) Release(ctx context.Context, id, worker string) error {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Release")
+	defer span.End()
+
+	if err := validateWorkerID(worker); err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return err
+	}
+
+	defer tm.locks.lock(id)()
+
+	current, err := tm.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	now := tm.clock.Now()
+	switch holder := current.claimedBy(now); holder {
+	case "":
+		if current.ClaimedBy == "" {
+			return nil
+		}
+	case worker:
+	default:
+		err := fmt.Errorf("%w: %s holds %s", ErrClaimHeld, holder, id)
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return err
+	}
+
+	task := *current
+	task.ClaimedBy = ""
+	task.ClaimExpiresAt = nil
+	task.UpdatedAt = now
+
+	if err := tm.storage.Set(ctx, id, &task); err != nil {
+		return err
+	}
+	tm.stats.replace(current, &task)
+	tm.version.Add(1)
+	tm.logger.Info("Task released", "id", id, "worker", worker)
+	tm.hooks.Publish(EventUpdated, &task)
+
+	return nil
+}
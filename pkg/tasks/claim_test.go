@@ -0,0 +1,119 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// claim claims the task for worker and fails the test unless the result is
+// want
+func (env testEnv) claim(tb testing.TB, id, worker string, ttl time.Duration, want bool) {
+	tb.Helper()
+	claimed, err := env.tm.Claim(context.Background(), id, worker, ttl)
+	if err != nil {
+		tb.Fatalf("%s claiming: %v", worker, err)
+	}
+	if claimed != want {
+		tb.Fatalf("%s claiming: got %v, want %v", worker, claimed, want)
+	}
+}
+
+func TestClaimContention(t *testing.T) {
+	env := newTestEnv(t)
+	task := env.mustCreate(t, CreateParams{Title: "contended"})
+
+	const workers = 50
+	winners := make(chan string, workers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker := fmt.Sprintf("worker-%d", i)
+			claimed, err := env.tm.Claim(context.Background(), task.ID, worker, time.Minute)
+			if err != nil {
+				t.Errorf("%s claiming: %v", worker, err)
+			}
+			if claimed {
+				winners <- worker
+			}
+		}()
+	}
+	wg.Wait()
+	close(winners)
+
+	var got []string
+	for worker := range winners {
+		got = append(got, worker)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got claims by %v, want exactly one", got)
+	}
+	stored, err := env.tm.Get(context.Background(), task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ClaimedBy != got[0] {
+		t.Fatalf("task is claimed by %s, want the winner %s", stored.ClaimedBy, got[0])
+	}
+}
+
+func TestClaimExpiry(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	task := env.mustCreate(t, CreateParams{Title: "claimed"})
+
+	env.claim(t, task.ID, "alice", time.Minute, true)
+	env.claim(t, task.ID, "bob", time.Minute, false)
+
+	// Claiming again extends the claim from now
+	env.clock.Advance(30 * time.Second)
+	env.claim(t, task.ID, "alice", time.Minute, true)
+	expires := env.clock.Now().Add(time.Minute)
+
+	env.clock.Set(expires.Add(-time.Nanosecond))
+	env.claim(t, task.ID, "bob", time.Minute, false)
+	if err := env.tm.Release(ctx, task.ID, "bob"); !errors.Is(err, ErrClaimHeld) {
+		t.Fatalf("releasing another worker's claim: got error %v, want %v", err, ErrClaimHeld)
+	}
+
+	// The claim ends at its expiry time
+	env.clock.Set(expires)
+	env.claim(t, task.ID, "bob", time.Minute, true)
+
+	if err := env.tm.Release(ctx, task.ID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := env.tm.Get(ctx, task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ClaimedBy != "" || stored.ClaimExpiresAt != nil {
+		t.Fatalf("released task is still claimed by %s until %v", stored.ClaimedBy, stored.ClaimExpiresAt)
+	}
+	env.claim(t, task.ID, "alice", time.Minute, true)
+}
+
+func TestReleaseExpiredClaim(t *testing.T) {
+	env := newTestEnv(t)
+	task := env.mustCreate(t, CreateParams{Title: "abandoned"})
+
+	env.claim(t, task.ID, "alice", time.Minute, true)
+	env.clock.Advance(time.Minute)
+
+	// Anyone can clear a claim that has expired
+	if err := env.tm.Release(context.Background(), task.ID, "bob"); err != nil {
+		t.Fatalf("releasing an expired claim: %v", err)
+	}
+	stored, err := env.tm.Get(context.Background(), task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ClaimedBy != "" {
+		t.Fatalf("expired claim by %s was kept", stored.ClaimedBy)
+	}
+}
@@ -0,0 +1,46 @@
+package tasks
+
+import (
+	"context"
+	"unicode/utf8"
+)
+
+// duplicatePrefix starts the title of a duplicated task
+const duplicatePrefix = "Copy of "
+
+// Duplicate creates a task from the title, description and labels of
+// another, as a starting point for similar work. The copy is a new task in
+// the default status: its title gets duplicatePrefix, and its assignee,
+// effort, order, watchers and other state are not copied.
+func (tm *taskManager) Duplicate(ctx context.Context, id string) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Duplicate")
+	defer span.End()
+
+	source, err := tm.load(ctx, id)
+	if err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return nil, err
+	}
+
+	// Create counts its own errors
+	task, err := tm.Create(ctx, CreateParams{
+		Title:       tm.duplicateTitle(source.Title),
+		Description: source.Description,
+		Labels:      source.Labels,
+	})
+	if err != nil {
+		return nil, err
+	}
+	tm.logger.Info("Task duplicated", "id", task.ID, "source", id)
+	return task, nil
+}
+
+// duplicateTitle returns title with duplicatePrefix, cut to the maximum
+// title length so that copying a long title does not fail
+func (tm *taskManager) duplicateTitle(title string) string {
+	title = duplicatePrefix + title
+	if utf8.RuneCountInString(title) <= tm.cfg.MaxTitleLength {
+		return title
+	}
+	return string([]rune(title)[:tm.cfg.MaxTitleLength])
+}
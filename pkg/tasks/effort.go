@@ -0,0 +1,87 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+)
+
+// Effort sums the estimated and spent time of a set of tasks
+type Effort struct {
+	// Tasks is the number of tasks summed, of which Unestimated have no
+	// estimate
+	Tasks       int `json:"tasks"`
+	Unestimated int `json:"unestimated_tasks"`
+
+	EstimatedMinutes int `json:"estimated_minutes"`
+	SpentMinutes     int `json:"spent_minutes"`
+	// RemainingMinutes is the estimated time not yet spent on open tasks.
+	// Tasks without an estimate, over their estimate or in a terminal
+	// status add nothing.
+	RemainingMinutes int `json:"remaining_minutes"`
+}
+
+// add counts task towards the effort (delta 1) or removes it (delta -1),
+// with terminal the set of statuses that leave nothing remaining. Archived
+// tasks are left out.
+func (e *Effort) add(task *Task, delta int, terminal map[string]bool) {
+	if task.Archived {
+		return
+	}
+
+	e.Tasks += delta
+	e.EstimatedMinutes += delta * task.EstimateMinutes
+	e.SpentMinutes += delta * task.SpentMinutes
+	if task.EstimateMinutes == 0 {
+		e.Unestimated += delta
+		return
+	}
+	if !terminal[task.Status] {
+		e.RemainingMinutes += delta * max(0, task.EstimateMinutes-task.SpentMinutes)
+	}
+}
+
+// Effort sums the estimated and spent time of the unarchived tasks assigned
+// to assignee, or of every unarchived task if assignee is empty
+func (tm *taskManager) Effort(ctx context.Context, assignee string) (Effort, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Effort")
+	defer span.End()
+
+	if assignee == "" {
+		ts, err := tm.taskStats(ctx)
+		if err != nil {
+			return Effort{}, err
+		}
+		return ts.effort, nil
+	}
+
+	list, err := tm.List(ctx, Filter{})
+	if err != nil {
+		return Effort{}, err
+	}
+
+	var effort Effort
+	for _, task := range list {
+		if task.Assignee == assignee {
+			effort.add(task, 1, tm.terminal)
+		}
+	}
+	return effort, nil
+}
+
+// validateEffort checks that the estimate and time spent are not negative
+func validateEffort(task *Task) []FieldError {
+	var fields []FieldError
+	if task.EstimateMinutes < 0 {
+		fields = append(fields, FieldError{
+			Field:   "estimate_minutes",
+			Message: fmt.Sprintf("must not be negative, got %d", task.EstimateMinutes),
+		})
+	}
+	if task.SpentMinutes < 0 {
+		fields = append(fields, FieldError{
+			Field:   "spent_minutes",
+			Message: fmt.Sprintf("must not be negative, got %d", task.SpentMinutes),
+		})
+	}
+	return fields
+}
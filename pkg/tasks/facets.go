@@ -0,0 +1,40 @@
+package tasks
+
+import "context"
+
+// Fields counted by Facets. Label values are given as key=value, the form
+// taken by the label filter.
+const (
+	FacetStatus   = "status"
+	FacetAssignee = "assignee"
+	FacetLabel    = "label"
+)
+
+// Facets counts the unarchived tasks by each distinct status, assignee and
+// label in use, such as for the options of a filter. Every field is present,
+// with an empty map if no task has a value for it.
+func (tm *taskManager) Facets(ctx context.Context) (map[string]map[string]int, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Facets")
+	defer span.End()
+
+	list, err := tm.List(ctx, Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	facets := map[string]map[string]int{
+		FacetStatus:   {},
+		FacetAssignee: {},
+		FacetLabel:    {},
+	}
+	for _, task := range list {
+		facets[FacetStatus][task.Status]++
+		if task.Assignee != "" {
+			facets[FacetAssignee][task.Assignee]++
+		}
+		for key, value := range task.Labels {
+			facets[FacetLabel][key+"="+value]++
+		}
+	}
+	return facets, nil
+}
@@ -0,0 +1,55 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxIDLength is the length of the longest valid task ID, well above the
+// "task-" prefix and a UUID or ULID
+const MaxIDLength = 128
+
+// ErrInvalidID is returned for a task ID that no task can have
+var ErrInvalidID = errors.New("invalid task ID")
+
+// ReserveIDs keeps Upsert from creating tasks with the given IDs. The API
+// reserves the fixed paths it serves under /tasks/, as a task with one of
+// those IDs could be stored but never reached by its URL.
+func (tm *taskManager) ReserveIDs(ids ...string) {
+	tm.reservedMu.Lock()
+	defer tm.reservedMu.Unlock()
+
+	for _, id := range ids {
+		tm.reserved[id] = true
+	}
+}
+
+// isReserved reports whether id was reserved with ReserveIDs
+func (tm *taskManager) isReserved(id string) bool {
+	tm.reservedMu.RLock()
+	defer tm.reservedMu.RUnlock()
+
+	return tm.reserved[id]
+}
+
+// ValidateID checks that id has the shape of a task ID: 1 to MaxIDLength
+// ASCII letters, digits, '-' and '_'. Every generated ID passes, so an ID
+// that fails cannot name a task and is rejected before reaching storage.
+func ValidateID(id string) error {
+	switch {
+	case id == "":
+		return fmt.Errorf("%w: must not be empty", ErrInvalidID)
+	case len(id) > MaxIDLength:
+		return fmt.Errorf("%w: must be at most %d characters", ErrInvalidID, MaxIDLength)
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_':
+		default:
+			return fmt.Errorf("%w: %q may only contain letters, digits, '-' and '_'", ErrInvalidID, id)
+		}
+	}
+	return nil
+}
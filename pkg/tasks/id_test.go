@@ -0,0 +1,126 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bhargavparmar/hive-demo/pkg/idgen"
+	"github.com/bhargavparmar/hive-demo/pkg/storage"
+	"github.com/cilium/hive"
+	"github.com/cilium/hive/cell"
+)
+
+// adversarialIDs are IDs no task can have
+var adversarialIDs = []string{
+	"",
+	"../etc",
+	"..",
+	"../../etc/passwd",
+	"a/b",
+	`a\b`,
+	"a b",
+	"task\n",
+	"\x00",
+	"a.b",
+	"t\u00e2sk",
+	"task-\u200b",
+	"%2e%2e",
+	strings.Repeat("a", MaxIDLength+1),
+}
+
+func TestValidateID(t *testing.T) {
+	for _, id := range adversarialIDs {
+		if err := ValidateID(id); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("ValidateID(%q) = %v, want %v", id, err, ErrInvalidID)
+		}
+	}
+
+	for _, id := range []string{
+		"a",
+		"task-0",
+		"task-9f0c0b8e-3a7c-4c1e-9f5e-2b1d6c7a8e90",
+		"task-01HZY7X3K5M2N8P4Q6R9S0T1V2",
+		"snake_case",
+		strings.Repeat("a", MaxIDLength),
+	} {
+		if err := ValidateID(id); err != nil {
+			t.Errorf("ValidateID(%q) = %v, want nil", id, err)
+		}
+	}
+}
+
+// countingReads counts the calls to Get
+type countingReads struct {
+	storage.Storage
+	gets *atomic.Int64
+}
+
+func (s countingReads) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	s.gets.Add(1)
+	return s.Storage.Get(ctx, key)
+}
+
+func TestInvalidIDNeverReachesStorage(t *testing.T) {
+	env := newTestEnv(t)
+	var gets atomic.Int64
+	env.tm.storage = countingReads{Storage: env.tm.storage, gets: &gets}
+	ctx := context.Background()
+
+	for _, id := range adversarialIDs {
+		if _, err := env.tm.Get(ctx, id); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("Get(%q) = %v, want %v", id, err, ErrInvalidID)
+		}
+		if err := env.tm.Delete(ctx, id, nil, false); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("Delete(%q) = %v, want %v", id, err, ErrInvalidID)
+		}
+	}
+	if n := gets.Load(); n != 0 {
+		t.Fatalf("storage was read %d times for invalid IDs", n)
+	}
+}
+
+func TestGeneratedIDsAreValid(t *testing.T) {
+	for _, strategy := range []string{idgen.StrategyUUID, idgen.StrategyULID} {
+		t.Run(strategy, func(t *testing.T) {
+			env := newTestEnv(t)
+
+			h := hive.New(
+				idgen.Cell,
+				cell.Invoke(func(g idgen.Generator) { env.tm.ids = g }),
+			)
+			hive.AddConfigOverride(h, func(cfg *idgen.Config) { cfg.Strategy = strategy })
+			if err := h.Populate(slog.New(slog.NewTextHandler(io.Discard, nil))); err != nil {
+				t.Fatal(err)
+			}
+
+			for range 1000 {
+				task := env.mustCreate(t, CreateParams{Title: "generated"})
+				if err := ValidateID(task.ID); err != nil {
+					t.Fatalf("generated ID %q is invalid: %v", task.ID, err)
+				}
+			}
+		})
+	}
+}
+
+func TestUpsertSkipsReservedIDs(t *testing.T) {
+	env := newTestEnv(t, func(cfg *Config) { cfg.UpsertCreateMissing = true })
+	ctx := context.Background()
+	env.tm.ReserveIDs("count")
+
+	results, err := env.tm.Upsert(ctx, []*Task{{ID: "count", Title: "shadowed"}, {ID: "counted", Title: "mine"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(results[0].Err, ErrInvalidID) {
+		t.Fatalf("upserting a reserved ID: got error %v, want %v", results[0].Err, ErrInvalidID)
+	}
+	if results[1].Err != nil {
+		t.Fatalf("upserting an unreserved ID: %v", results[1].Err)
+	}
+}
@@ -0,0 +1,147 @@
+package tasks
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidImport is returned when an import cannot be processed at all,
+// for example because the header row is missing or malformed
+var ErrInvalidImport = errors.New("invalid import")
+
+// importColumns are the columns an imported CSV file may have
+var importColumns = []string{"title", "description", "assignee"}
+
+// ImportResult is the outcome of an import. Tasks lists the created tasks
+// and Errors the rows that were skipped.
+type ImportResult struct {
+	Tasks  []*Task
+	Errors []ImportError
+}
+
+// ImportError describes why a row was not imported. Line is the line of the
+// file the row starts on, counting the header as line 1.
+type ImportError struct {
+	Line int
+	Err  error
+}
+
+// importRow is a parsed row waiting to be created
+type importRow struct {
+	line   int
+	params CreateParams
+}
+
+// ImportCSV creates a task from every row of a CSV file. The header row
+// names the columns: title is required, description and assignee are
+// optional and their order is free. Rows that cannot be parsed or fail to
+// create are skipped and reported in the result. The whole file is parsed
+// before any task is created, so a file with too many rows creates nothing.
+func (tm *taskManager) ImportCSV(ctx context.Context, r io.Reader) (ImportResult, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.ImportCSV")
+	defer span.End()
+
+	rows, result, err := parseImport(r)
+	if err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return ImportResult{}, err
+	}
+
+	result.Tasks = make([]*Task, 0, len(rows))
+	for _, row := range rows {
+		task, err := tm.Create(ctx, row.params)
+		if err != nil {
+			result.Errors = append(result.Errors, ImportError{Line: row.line, Err: err})
+			continue
+		}
+		result.Tasks = append(result.Tasks, task)
+	}
+
+	// Parse errors come first; keep the report in file order
+	slices.SortStableFunc(result.Errors, func(a, b ImportError) int {
+		return a.Line - b.Line
+	})
+	tm.logger.Info("Tasks imported", "created", len(result.Tasks), "failed", len(result.Errors))
+
+	return result, nil
+}
+
+// parseImport reads the rows of a CSV import. Rows that cannot be parsed
+// are returned as errors in the result.
+func parseImport(r io.Reader) ([]importRow, ImportResult, error) {
+	var result ImportResult
+
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil, result, fmt.Errorf("%w: missing header row", ErrInvalidImport)
+	case err != nil:
+		return nil, result, fmt.Errorf("%w: header row: %v", ErrInvalidImport, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(importColumns, name) {
+			return nil, result, fmt.Errorf("%w: unknown column %q, expected %s", ErrInvalidImport, name, strings.Join(importColumns, ", "))
+		}
+		if _, ok := columns[name]; ok {
+			return nil, result, fmt.Errorf("%w: column %q appears more than once", ErrInvalidImport, name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, result, fmt.Errorf("%w: missing title column", ErrInvalidImport)
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			result.Errors = append(result.Errors, ImportError{
+				Line: parseErr.StartLine,
+				Err:  fmt.Errorf("%w: %v", ErrInvalidImport, parseErr.Err),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, result, err
+		}
+
+		if len(rows) == MaxBatchSize {
+			return nil, result, fmt.Errorf("%w: at most %d rows allowed", ErrInvalidBatch, MaxBatchSize)
+		}
+
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, importRow{
+			line: line,
+			params: CreateParams{
+				Title:       field(record, "title"),
+				Description: field(record, "description"),
+				Assignee:    field(record, "assignee"),
+			},
+		})
+	}
+
+	return rows, result, nil
+}
@@ -0,0 +1,44 @@
+package tasks
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// keyLockShards is the number of mutexes shared by all task IDs. Tasks that
+// hash to the same shard serialize, so it should comfortably exceed the
+// number of concurrent writers.
+const keyLockShards = 256
+
+// keyLocks serializes the read-modify-write cycles on each task, while
+// writes to different tasks usually proceed in parallel. A fixed set of
+// mutexes is used instead of one per task, so memory does not grow with
+// the number of tasks.
+type keyLocks struct {
+	seed   maphash.Seed
+	shards [keyLockShards]sync.Mutex
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{seed: maphash.MakeSeed()}
+}
+
+// lock locks the mutex for key and returns the function that unlocks it
+func (l *keyLocks) lock(key string) func() {
+	mu := &l.shards[maphash.String(l.seed, key)%keyLockShards]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// lockAll locks every mutex, in order, and returns the function that
+// unlocks them. It relies on no caller holding more than one key lock.
+func (l *keyLocks) lockAll() func() {
+	for i := range l.shards {
+		l.shards[i].Lock()
+	}
+	return func() {
+		for i := range l.shards {
+			l.shards[i].Unlock()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/storage"
+)
+
+// slowReads delays returning the value read by every Get, so that
+// concurrent read-modify-write cycles overlap unless something serializes
+// them
+type slowReads struct {
+	storage.Storage
+}
+
+func (s slowReads) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	val, ok, err := s.Storage.Get(ctx, key)
+	time.Sleep(100 * time.Microsecond)
+	return val, ok, err
+}
+
+// TestConcurrentUpdatesAreNotLost runs many updates of different fields of
+// one task at once. Each update is a read-modify-write, so without per-task
+// locking one based on a stale read would revert the fields written since.
+func TestConcurrentUpdatesAreNotLost(t *testing.T) {
+	env := newTestEnv(t)
+	env.tm.storage = slowReads{env.tm.storage}
+	ctx := context.Background()
+
+	const (
+		rounds  = 5
+		writers = 20
+	)
+	estimate, spent := 30, 45
+
+	for round := range rounds {
+		task := env.mustCreate(t, CreateParams{Title: fmt.Sprintf("round %d", round)})
+
+		var wg sync.WaitGroup
+		update := func(title, description string, estimate, spent *int) {
+			defer wg.Done()
+			if _, err := env.tm.Update(ctx, task.ID, title, description, "", nil, estimate, spent, false); err != nil {
+				t.Error(err)
+			}
+		}
+		for range writers {
+			wg.Add(4)
+			go update("renamed", "", nil, nil)
+			go update("", "described", nil, nil)
+			go update("", "", &estimate, nil)
+			go update("", "", nil, &spent)
+		}
+		wg.Wait()
+
+		got, err := env.tm.Get(ctx, task.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != "renamed" || got.Description != "described" || got.EstimateMinutes != estimate || got.SpentMinutes != spent {
+			t.Fatalf("round %d: lost an update, got title %q, description %q, estimate %d, spent %d",
+				round, got.Title, got.Description, got.EstimateMinutes, got.SpentMinutes)
+		}
+	}
+}
+
+// TestConcurrentPatchesAreNotLost has each writer merge its own label into
+// the same task, so every label written must survive
+func TestConcurrentPatchesAreNotLost(t *testing.T) {
+	env := newTestEnv(t)
+	env.tm.storage = slowReads{env.tm.storage}
+	ctx := context.Background()
+
+	// As many writers as a task may have labels
+	const (
+		rounds  = 5
+		writers = 32
+	)
+
+	for round := range rounds {
+		task := env.mustCreate(t, CreateParams{Title: fmt.Sprintf("round %d", round)})
+
+		var wg sync.WaitGroup
+		for i := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				patch := fmt.Sprintf(`{"labels":{"writer-%d":"done"}}`, i)
+				if _, err := env.tm.Patch(ctx, task.ID, []byte(patch), false); err != nil {
+					t.Errorf("writer %d: %v", i, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		got, err := env.tm.Get(ctx, task.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Labels) != writers {
+			t.Fatalf("round %d: got %d labels, want %d", round, len(got.Labels), writers)
+		}
+	}
+}
+
+func TestKeyLocksLockAll(t *testing.T) {
+	l := newKeyLocks()
+	unlock := l.lockAll()
+
+	locked := make(chan struct{})
+	go func() {
+		defer l.lock("task-1")()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("a key lock was taken while all were held")
+	default:
+	}
+	unlock()
+	<-locked
+}
@@ -0,0 +1,268 @@
+package tasks
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+)
+
+// ErrInvalidMove is returned when a task cannot be moved to the requested
+// position
+var ErrInvalidMove = errors.New("invalid move")
+
+// orderStep is the gap left between tasks when the order of a column is
+// rebalanced, and between the last task and one moved after it
+const orderStep = 1024
+
+// CompareOrder orders tasks by their manual order, breaking ties by creation
+func CompareOrder(a, b *Task) int {
+	return cmp.Or(cmp.Compare(a.Order, b.Order), compareCreated(a, b))
+}
+
+// Reorder moves a task within its status column to directly after the task
+// afterID, or to the top of the column if afterID is empty. The task gets an
+// order value between its new neighbours; when they are too close to split,
+// the column is first renumbered with even gaps.
+func (tm *taskManager) Reorder(ctx context.Context, id, afterID string) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Reorder")
+	defer span.End()
+
+	// Moves are serialized so that each one sees the result of the last
+	tm.orderMu.Lock()
+	defer tm.orderMu.Unlock()
+
+	task, ok, err := tm.move(ctx, id, afterID)
+	if err == nil && !ok {
+		if err = tm.rebalance(ctx, id); err == nil {
+			task, _, err = tm.move(ctx, id, afterID)
+		}
+	}
+	if err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return nil, err
+	}
+	return task, nil
+}
+
+// move gives the task an order value after afterID, reporting false if no
+// float64 lies strictly between its neighbours' orders
+func (tm *taskManager) move(ctx context.Context, id, afterID string) (*Task, bool, error) {
+	defer tm.locks.lock(id)()
+
+	current, err := tm.load(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+	column, err := tm.column(ctx, current.Status, id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The new order lies between prev and next, either of which may be
+	// missing at the ends of the column
+	i := 0
+	if afterID != "" {
+		i = slices.IndexFunc(column, func(t *Task) bool { return t.ID == afterID })
+		if i < 0 {
+			return nil, false, fmt.Errorf("%w: %s is not an unarchived %s task other than the one moved", ErrInvalidMove, afterID, current.Status)
+		}
+		i++
+	}
+
+	var order float64
+	switch {
+	case len(column) == 0:
+		return current, true, nil
+	case i == 0:
+		order = column[0].Order - orderStep
+	case i == len(column):
+		order = column[i-1].Order + orderStep
+	default:
+		// Orders start out as millisecond timestamps, where adjacent
+		// float64 values are far apart, so no fixed gap is small enough.
+		// Once the midpoint rounds to a neighbour the task would tie with
+		// it, and land on the wrong side of it.
+		prev, next := column[i-1].Order, column[i].Order
+		order = prev + (next-prev)/2
+		if order <= prev || order >= next {
+			return nil, false, nil
+		}
+	}
+
+	task := *current
+	task.Order = order
+	task.UpdatedAt = tm.clock.Now()
+	if err := tm.storage.Set(ctx, id, &task); err != nil {
+		return nil, false, err
+	}
+	tm.stats.replace(current, &task)
+	tm.version.Add(1)
+	tm.logger.Info("Task moved", "id", id, "after", afterID, "order", order)
+	tm.hooks.Publish(EventUpdated, &task)
+
+	return &task, true, nil
+}
+
+// column returns the unarchived tasks with the status in manual order,
+// leaving out the task exclude
+func (tm *taskManager) column(ctx context.Context, status, exclude string) ([]*Task, error) {
+	list, err := tm.List(ctx, Filter{Status: status})
+	if err != nil {
+		return nil, err
+	}
+	list = slices.DeleteFunc(list, func(t *Task) bool { return t.ID == exclude })
+	slices.SortStableFunc(list, CompareOrder)
+	return list, nil
+}
+
+// rebalance renumbers the column of the task with orderStep between
+// neighbours, keeping their order. Each task is locked and reloaded while it
+// is renumbered, so concurrent updates are not lost.
+func (tm *taskManager) rebalance(ctx context.Context, id string) error {
+	task, err := tm.load(ctx, id)
+	if err != nil {
+		return err
+	}
+	column, err := tm.column(ctx, task.Status, "")
+	if err != nil {
+		return err
+	}
+
+	tm.logger.Info("Rebalancing task order", "status", task.Status, "tasks", len(column))
+	for i, t := range column {
+		if err := tm.setOrder(ctx, t.ID, float64(i+1)*orderStep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setOrder stores a new order value for a task, if it still exists, as an
+// update of the task
+func (tm *taskManager) setOrder(ctx context.Context, id string, order float64) error {
+	defer tm.locks.lock(id)()
+
+	current, err := tm.load(ctx, id)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		return nil
+	case err != nil:
+		return err
+	case current.Order == order:
+		return nil
+	}
+
+	task := *current
+	task.Order = order
+	task.UpdatedAt = tm.clock.Now()
+	if err := tm.storage.Set(ctx, id, &task); err != nil {
+		return err
+	}
+	tm.stats.replace(current, &task)
+	tm.version.Add(1)
+	tm.hooks.Publish(EventUpdated, &task)
+	return nil
+}
+
+// SetOrders sets the order of several tasks at once, such as when a whole
+// board is saved, and returns them in their new order. Every task is checked
+// to exist before any is changed. Should storing one fail, the tasks already
+// changed are restored, as far as storage allows.
+func (tm *taskManager) SetOrders(ctx context.Context, orders map[string]float64) ([]*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.SetOrders")
+	defer span.End()
+
+	if err := validateOrders(orders); err != nil {
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, err
+	}
+
+	tm.orderMu.Lock()
+	defer tm.orderMu.Unlock()
+
+	ids := slices.Sorted(maps.Keys(orders))
+	var missing []string
+	for _, id := range ids {
+		if _, err := tm.load(ctx, id); errors.Is(err, ErrTaskNotFound) {
+			missing = append(missing, id)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(missing) > 0 {
+		tm.metrics.IncrementErrorsByType(metrics.ErrorNotFound)
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, strings.Join(missing, ", "))
+	}
+
+	updated := make([]*Task, 0, len(ids))
+	previous := make(map[string]float64, len(ids))
+	for _, id := range ids {
+		old, task, err := tm.reorderOne(ctx, id, orders[id])
+		if err != nil {
+			tm.logger.Error("Setting task orders failed, restoring", "id", id, "error", err)
+			for restoreID, order := range previous {
+				if _, _, err := tm.reorderOne(ctx, restoreID, order); err != nil {
+					tm.logger.Error("Restoring task order failed", "id", restoreID, "error", err)
+				}
+			}
+			return nil, err
+		}
+		previous[id] = old
+		updated = append(updated, task)
+	}
+
+	for _, task := range updated {
+		tm.hooks.Publish(EventUpdated, task)
+	}
+	tm.logger.Info("Task orders set", "tasks", len(updated))
+
+	slices.SortStableFunc(updated, CompareOrder)
+	return updated, nil
+}
+
+// reorderOne stores a new order for a task, returning its previous order
+func (tm *taskManager) reorderOne(ctx context.Context, id string, order float64) (float64, *Task, error) {
+	defer tm.locks.lock(id)()
+
+	current, err := tm.load(ctx, id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	task := *current
+	task.Order = order
+	task.UpdatedAt = tm.clock.Now()
+	if err := tm.storage.Set(ctx, id, &task); err != nil {
+		return 0, nil, err
+	}
+	tm.stats.replace(current, &task)
+	tm.version.Add(1)
+	return current.Order, &task, nil
+}
+
+// validateOrders checks the size of an order batch and that every order is
+// a finite number
+func validateOrders(orders map[string]float64) error {
+	switch {
+	case len(orders) == 0:
+		return fmt.Errorf("%w: no tasks given", ErrInvalidBatch)
+	case len(orders) > MaxBatchSize:
+		return fmt.Errorf("%w: at most %d tasks allowed, got %d", ErrInvalidBatch, MaxBatchSize, len(orders))
+	}
+	for _, id := range slices.Sorted(maps.Keys(orders)) {
+		if err := ValidateID(id); err != nil {
+			return err
+		}
+		if order := orders[id]; math.IsNaN(order) || math.IsInf(order, 0) {
+			return fmt.Errorf("%w: order of %s must be a finite number", ErrInvalidBatch, id)
+		}
+	}
+	return nil
+}
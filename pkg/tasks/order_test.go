@@ -0,0 +1,154 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/webhooks"
+)
+
+// recordedEvents is a webhook dispatcher that records the published events
+type recordedEvents struct {
+	webhooks.Dispatcher
+
+	mu     sync.Mutex
+	events []recordedEvent
+}
+
+type recordedEvent struct {
+	kind string
+	task Task
+}
+
+func (r *recordedEvents) Publish(kind string, data interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if task, ok := data.(*Task); ok {
+		r.events = append(r.events, recordedEvent{kind: kind, task: *task})
+	}
+}
+
+// updated returns the IDs of the tasks with a task.updated event
+func (r *recordedEvents) updated() map[string]bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make(map[string]bool)
+	for _, e := range r.events {
+		if e.kind == EventUpdated {
+			ids[e.task.ID] = true
+		}
+	}
+	return ids
+}
+
+// columnIDs returns the IDs of the tasks with the status in manual order
+func (env testEnv) columnIDs(tb testing.TB, status string) []string {
+	tb.Helper()
+	column, err := env.tm.column(context.Background(), status, "")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ids := make([]string, len(column))
+	for i, task := range column {
+		ids[i] = task.ID
+	}
+	return ids
+}
+
+func TestRepeatedMovesIntoOneGap(t *testing.T) {
+	// Each move halves the gap left between the moved task and one of its
+	// neighbours, until their midpoint rounds to one of them. Orders start
+	// as millisecond timestamps, where that happens while the gap is still
+	// far wider than any fixed epsilon.
+	for _, tc := range []struct {
+		name string
+		// toward is the neighbour whose gap to the moved task shrinks
+		toward string
+	}{
+		{name: "toward the previous task", toward: "prev"},
+		{name: "toward the next task", toward: "next"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+
+			first := env.mustCreate(t, CreateParams{Title: "first"})
+			env.clock.Advance(time.Millisecond)
+			last := env.mustCreate(t, CreateParams{Title: "last"})
+
+			// moved holds the moved tasks in the order expected between
+			// first and last
+			var moved []string
+			for i := range 60 {
+				env.clock.Advance(time.Millisecond)
+				task := env.mustCreate(t, CreateParams{Title: fmt.Sprintf("moved %d", i)})
+
+				after := first.ID
+				if tc.toward == "next" && len(moved) > 0 {
+					after = moved[len(moved)-1]
+				}
+				if _, err := env.tm.Reorder(ctx, task.ID, after); err != nil {
+					t.Fatalf("move %d: %v", i, err)
+				}
+				if tc.toward == "next" {
+					moved = append(moved, task.ID)
+				} else {
+					moved = append([]string{task.ID}, moved...)
+				}
+
+				want := append(append([]string{first.ID}, moved...), last.ID)
+				if got := env.columnIDs(t, task.Status); fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Fatalf("move %d: got column %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRebalanceUpdatesTasks(t *testing.T) {
+	env := newTestEnv(t)
+	events := &recordedEvents{}
+	env.tm.hooks = events
+	ctx := context.Background()
+
+	first := env.mustCreate(t, CreateParams{Title: "first"})
+	env.clock.Advance(time.Millisecond)
+	second := env.mustCreate(t, CreateParams{Title: "second"})
+	env.clock.Advance(time.Millisecond)
+	moved := env.mustCreate(t, CreateParams{Title: "moved"})
+
+	// With first and second tied nothing fits between them, so moving
+	// there renumbers the column
+	if _, err := env.tm.SetOrders(ctx, map[string]float64{first.ID: 5, second.ID: 5}); err != nil {
+		t.Fatal(err)
+	}
+	events.mu.Lock()
+	events.events = nil
+	events.mu.Unlock()
+
+	env.clock.Advance(time.Minute)
+	if _, err := env.tm.Reorder(ctx, moved.ID, first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := env.columnIDs(t, first.Status), []string{first.ID, moved.ID, second.ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got column %v, want %v", got, want)
+	}
+
+	updated := events.updated()
+	for _, task := range []*Task{first, second, moved} {
+		got, err := env.tm.Get(ctx, task.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.UpdatedAt.Equal(env.clock.Now()) {
+			t.Errorf("%s: got UpdatedAt %v, want %v", task.Title, got.UpdatedAt, env.clock.Now())
+		}
+		if !updated[task.ID] {
+			t.Errorf("%s: no %s event published", task.Title, EventUpdated)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package tasks
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateWindow is the period over which the per-assignee create limit applies
+const rateWindow = time.Minute
+
+// assigneeLimiter is a token bucket per assignee. Each bucket holds up to
+// limit tokens and refills at limit tokens per rateWindow. Buckets that
+// have been idle long enough to refill completely are dropped.
+type assigneeLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newAssigneeLimiter(limit int) *assigneeLimiter {
+	return &assigneeLimiter{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the assignee's bucket, reporting false if there
+// is none left
+func (l *assigneeLimiter) Allow(assignee string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateWindow {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[assignee]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit), last: now}
+		l.buckets[assignee] = b
+	}
+
+	refill := now.Sub(b.last).Seconds() / rateWindow.Seconds() * float64(l.limit)
+	b.tokens = min(float64(l.limit), b.tokens+refill)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep drops the buckets that would be full again by now
+func (l *assigneeLimiter) sweep(now time.Time) {
+	for assignee, b := range l.buckets {
+		if now.Sub(b.last) >= rateWindow {
+			delete(l.buckets, assignee)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (tm *taskManager) SetCreateRatePerAssignee(limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("task-create-rate-per-assignee must not be negative, got %d", limit)
+	}
+
+	if limit == 0 {
+		tm.limiter.Store(nil)
+	} else {
+		tm.limiter.Store(newAssigneeLimiter(limit))
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRejectedCreateKeepsRateAllowance(t *testing.T) {
+	env := newTestEnv(t, func(cfg *Config) {
+		cfg.CreateRatePerAssignee = 1
+		cfg.UniqueTitles = true
+	})
+	ctx := context.Background()
+
+	env.mustCreate(t, CreateParams{Title: "taken"})
+
+	// A duplicate title is rejected before the limiter is consulted
+	_, err := env.tm.Create(ctx, CreateParams{Title: "taken", Assignee: "alice"})
+	if !errors.Is(err, ErrDuplicateTitle) {
+		t.Fatalf("got error %v, want %v", err, ErrDuplicateTitle)
+	}
+
+	env.mustCreate(t, CreateParams{Title: "first", Assignee: "alice"})
+
+	_, err = env.tm.Create(ctx, CreateParams{Title: "second", Assignee: "alice"})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("got error %v, want %v", err, ErrRateLimited)
+	}
+}
@@ -0,0 +1,230 @@
+package tasks
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/storage"
+)
+
+// reminder is a task whose due date is announced at a set time
+type reminder struct {
+	id  string
+	due time.Time
+	at  time.Time
+	// index is the position in the heap, kept up to date by it
+	index int
+}
+
+// reminderHeap orders reminders by the time they fire, earliest first
+type reminderHeap []*reminder
+
+func (h reminderHeap) Len() int           { return len(h) }
+func (h reminderHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h reminderHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *reminderHeap) Push(x any) {
+	r := x.(*reminder)
+	r.index = len(*h)
+	*h = append(*h, r)
+}
+
+func (h *reminderHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return r
+}
+
+// reminders holds the upcoming reminders. It is only used by the goroutine
+// running runReminders, so it needs no lock.
+type reminders struct {
+	queue reminderHeap
+	byID  map[string]*reminder
+	// sent maps the tasks already reminded of to their due date then, so
+	// an unrelated change to a task does not remind of it again
+	sent map[string]time.Time
+}
+
+func newReminders() *reminders {
+	return &reminders{
+		byID: make(map[string]*reminder),
+		sent: make(map[string]time.Time),
+	}
+}
+
+// set schedules the reminder for a task, replacing any it had, or removes
+// it when the task no longer needs one
+func (rs *reminders) set(id string, due, at time.Time) {
+	if sent, ok := rs.sent[id]; ok && !sent.Equal(due) {
+		delete(rs.sent, id)
+	}
+	if due.IsZero() {
+		rs.remove(id)
+		delete(rs.sent, id)
+		return
+	}
+	if _, ok := rs.sent[id]; ok {
+		rs.remove(id)
+		return
+	}
+
+	if r, ok := rs.byID[id]; ok {
+		r.due, r.at = due, at
+		heap.Fix(&rs.queue, r.index)
+		return
+	}
+	r := &reminder{id: id, due: due, at: at}
+	rs.byID[id] = r
+	heap.Push(&rs.queue, r)
+}
+
+// remove drops the reminder for a task, if it has one
+func (rs *reminders) remove(id string) {
+	if r, ok := rs.byID[id]; ok {
+		heap.Remove(&rs.queue, r.index)
+		delete(rs.byID, id)
+	}
+}
+
+// next returns the earliest reminder without removing it, nil if there is
+// none
+func (rs *reminders) next() *reminder {
+	if len(rs.queue) == 0 {
+		return nil
+	}
+	return rs.queue[0]
+}
+
+// pop removes the earliest reminder and records it as sent
+func (rs *reminders) pop() *reminder {
+	r := heap.Pop(&rs.queue).(*reminder)
+	delete(rs.byID, r.id)
+	rs.sent[r.id] = r.due
+	return r
+}
+
+// dueDate returns the due date a task is reminded of, zero if it needs no
+// reminder because it has no due date, is archived, or is in a terminal
+// status
+func (tm *taskManager) dueDate(task *Task) time.Time {
+	if task.DueAt == nil || task.Archived || tm.terminal[task.Status] {
+		return time.Time{}
+	}
+	return *task.DueAt
+}
+
+// startReminders loads the due dates of the stored tasks and starts
+// following storage changes, publishing EventDueSoon for each task once its
+// due date is less than ReminderLeadTime away. Reminders that should have
+// been sent before the start are skipped, as an earlier run may have sent
+// them.
+func (tm *taskManager) startReminders(ctx context.Context) error {
+	// Subscribe before listing so no change in between is missed
+	events, unsubscribe := tm.storage.Subscribe()
+
+	list, err := tm.List(ctx, Filter{})
+	if err != nil {
+		unsubscribe()
+		return err
+	}
+
+	rs := newReminders()
+	now := tm.clock.Now()
+	for _, task := range list {
+		due := tm.dueDate(task)
+		if at := due.Add(-tm.cfg.ReminderLeadTime); !due.IsZero() && at.After(now) {
+			rs.set(task.ID, due, at)
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	tm.stopReminders = func() {
+		cancel()
+		unsubscribe()
+	}
+	tm.remindersDone = make(chan struct{})
+	go func() {
+		defer close(tm.remindersDone)
+		tm.runReminders(runCtx, rs, events)
+	}()
+
+	tm.logger.Info("Task reminders started", "lead_time", tm.cfg.ReminderLeadTime, "scheduled", len(rs.queue))
+	return nil
+}
+
+// runReminders keeps the reminders in step with storage changes and sends
+// each when its time comes, until ctx is cancelled
+func (tm *taskManager) runReminders(ctx context.Context, rs *reminders, events <-chan storage.StorageEvent) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		// Send every reminder whose time has come, then sleep until the
+		// next one
+		for r := rs.next(); r != nil && !r.at.After(tm.clock.Now()); r = rs.next() {
+			tm.remind(ctx, rs.pop())
+		}
+
+		timer.Stop()
+		var wake <-chan time.Time
+		if r := rs.next(); r != nil {
+			timer.Reset(r.at.Sub(tm.clock.Now()))
+			wake = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			tm.applyReminderEvent(rs, event)
+		}
+	}
+}
+
+// applyReminderEvent updates the reminder of the task a storage change is
+// about
+func (tm *taskManager) applyReminderEvent(rs *reminders, event storage.StorageEvent) {
+	if event.Kind == storage.EventDelete {
+		rs.set(event.Key, time.Time{}, time.Time{})
+		return
+	}
+
+	task, ok := asTask(event.Value)
+	if !ok {
+		return
+	}
+	due := tm.dueDate(task)
+	rs.set(task.ID, due, due.Add(-tm.cfg.ReminderLeadTime))
+}
+
+// remind publishes EventDueSoon for a task, unless it changed in a way the
+// reminders have not seen yet, such as through a dropped storage event
+func (tm *taskManager) remind(ctx context.Context, r *reminder) {
+	task, err := tm.load(ctx, r.id)
+	if err != nil {
+		tm.logger.Debug("Skipping reminder for unavailable task", "id", r.id, "error", err)
+		return
+	}
+	if due := tm.dueDate(task); !due.Equal(r.due) {
+		return
+	}
+	// A due date set or moved into the past is not coming up
+	if !r.due.After(tm.clock.Now()) {
+		return
+	}
+
+	tm.logger.Info("Task due soon", "id", task.ID, "due_at", r.due)
+	tm.hooks.Publish(EventDueSoon, task)
+}
@@ -0,0 +1,108 @@
+package tasks
+
+import (
+	"maps"
+	"sync"
+)
+
+// taskStats are the stats derived from the stored tasks
+type taskStats struct {
+	total    int
+	archived int
+	starred  int
+	byStatus map[string]int
+	effort   Effort
+}
+
+// taskCounters keeps the task stats up to date as tasks change, so that
+// reading them does not require listing every task
+type taskCounters struct {
+	mu    sync.Mutex
+	stats taskStats
+	// titles counts the tasks with each title, nil unless titles are
+	// tracked
+	titles map[string]int
+	// terminal is the set of statuses whose tasks have no remaining effort
+	terminal map[string]bool
+}
+
+// newTaskCounters returns empty counters, tracking titles if asked to
+func newTaskCounters(trackTitles bool, terminal map[string]bool) *taskCounters {
+	c := &taskCounters{stats: taskStats{byStatus: make(map[string]int)}, terminal: terminal}
+	if trackTitles {
+		c.titles = make(map[string]int)
+	}
+	return c
+}
+
+// add counts task as stored (delta 1) or removed (delta -1)
+func (c *taskCounters) add(task *Task, delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.count(task, delta)
+}
+
+// replace counts old as removed and updated as stored
+func (c *taskCounters) replace(old, updated *Task) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.count(old, -1)
+	c.count(updated, 1)
+}
+
+func (c *taskCounters) count(task *Task, delta int) {
+	c.stats.total += delta
+	if task.Archived {
+		c.stats.archived += delta
+	}
+	if task.Starred {
+		c.stats.starred += delta
+	}
+	c.stats.byStatus[task.Status] += delta
+	if c.stats.byStatus[task.Status] == 0 {
+		delete(c.stats.byStatus, task.Status)
+	}
+	c.stats.effort.add(task, delta, c.terminal)
+
+	if c.titles != nil {
+		c.titles[task.Title] += delta
+		if c.titles[task.Title] == 0 {
+			delete(c.titles, task.Title)
+		}
+	}
+}
+
+// reset recounts the stats from a full list of tasks
+func (c *taskCounters) reset(tasks []*Task) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats = taskStats{byStatus: make(map[string]int)}
+	if c.titles != nil {
+		c.titles = make(map[string]int)
+	}
+	for _, task := range tasks {
+		c.count(task, 1)
+	}
+}
+
+// snapshot returns a copy of the current stats
+func (c *taskCounters) snapshot() taskStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.byStatus = maps.Clone(c.stats.byStatus)
+	return stats
+}
+
+// titleCount returns the number of tasks with the title, or 0 if titles are
+// not tracked
+func (c *taskCounters) titleCount(title string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.titles[title]
+}
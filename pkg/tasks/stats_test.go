@@ -0,0 +1,188 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bhargavparmar/hive-demo/pkg/storage"
+	"github.com/cilium/hive"
+)
+
+// expectStats fails the test unless GetStats reports the wanted totals
+func (env testEnv) expectStats(tb testing.TB, total, archived, starred int, byStatus map[string]int) {
+	tb.Helper()
+	stats, err := env.tm.GetStats(context.Background())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if stats["total_tasks"] != total || stats["archived_tasks"] != archived || stats["starred_tasks"] != starred {
+		tb.Fatalf("got %v total, %v archived and %v starred tasks, want %d, %d and %d",
+			stats["total_tasks"], stats["archived_tasks"], stats["starred_tasks"], total, archived, starred)
+	}
+	if got := stats["by_status"].(map[string]int); !maps.Equal(got, byStatus) {
+		tb.Fatalf("got tasks by status %v, want %v", got, byStatus)
+	}
+}
+
+func TestStatsReflectWritesImmediately(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.expectStats(t, 0, 0, 0, map[string]int{})
+
+	task := env.mustCreate(t, CreateParams{Title: "counted"})
+	env.expectStats(t, 1, 0, 0, map[string]int{StatusPending: 1})
+
+	if _, err := env.tm.Update(ctx, task.ID, "", "", StatusInProgress, nil, nil, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	env.expectStats(t, 1, 0, 0, map[string]int{StatusInProgress: 1})
+
+	if _, err := env.tm.Patch(ctx, task.ID, []byte(`{"status":"completed"}`), false); err != nil {
+		t.Fatal(err)
+	}
+	env.expectStats(t, 1, 0, 0, map[string]int{StatusCompleted: 1})
+
+	if _, err := env.tm.Star(ctx, task.ID); err != nil {
+		t.Fatal(err)
+	}
+	env.expectStats(t, 1, 0, 1, map[string]int{StatusCompleted: 1})
+
+	if _, err := env.tm.Archive(ctx, task.ID); err != nil {
+		t.Fatal(err)
+	}
+	env.expectStats(t, 1, 1, 1, map[string]int{StatusCompleted: 1})
+
+	// A dry run changes nothing
+	if err := env.tm.Delete(ctx, task.ID, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	env.expectStats(t, 1, 1, 1, map[string]int{StatusCompleted: 1})
+
+	if err := env.tm.Delete(ctx, task.ID, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	env.expectStats(t, 0, 0, 0, map[string]int{})
+}
+
+func TestCountersMatchRecount(t *testing.T) {
+	env := newTestEnv(t, uniqueTitles)
+	ctx := context.Background()
+	rng := rand.New(rand.NewPCG(1, 2))
+	statuses := []string{StatusPending, StatusInProgress, StatusCompleted, StatusCancelled}
+
+	var ids []string
+	for i := range 2000 {
+		if len(ids) == 0 || rng.IntN(4) == 0 {
+			estimate := rng.IntN(3) * 30
+			task := env.mustCreate(t, CreateParams{
+				Title:           fmt.Sprintf("task %d", i),
+				Status:          statuses[rng.IntN(len(statuses))],
+				EstimateMinutes: estimate,
+				SpentMinutes:    rng.IntN(60),
+			})
+			ids = append(ids, task.ID)
+			continue
+		}
+
+		n := rng.IntN(len(ids))
+		id := ids[n]
+		var err error
+		switch rng.IntN(9) {
+		case 0:
+			_, err = env.tm.Update(ctx, id, "", "", statuses[rng.IntN(len(statuses))], nil, nil, nil, false)
+		case 1:
+			_, err = env.tm.Patch(ctx, id, []byte(fmt.Sprintf(`{"title":"renamed %d","estimate_minutes":%d}`, i, rng.IntN(120))), false)
+		case 2:
+			_, err = env.tm.Star(ctx, id)
+		case 3:
+			_, err = env.tm.Unstar(ctx, id)
+		case 4:
+			_, err = env.tm.Archive(ctx, id)
+		case 5:
+			_, err = env.tm.Unarchive(ctx, id)
+		case 6:
+			var results []BatchResult
+			results, err = env.tm.Upsert(ctx, []*Task{{ID: id, Title: fmt.Sprintf("upserted %d", i), Status: statuses[rng.IntN(len(statuses))]}})
+			if err == nil {
+				err = results[0].Err
+			}
+		case 7:
+			// A second copy of the same task takes a title in use
+			var task *Task
+			switch task, err = env.tm.Duplicate(ctx, id); {
+			case err == nil:
+				ids = append(ids, task.ID)
+			case errors.Is(err, ErrDuplicateTitle):
+				err = nil
+			}
+		case 8:
+			err = env.tm.Delete(ctx, id, nil, false)
+			ids = append(ids[:n], ids[n+1:]...)
+		}
+		if err != nil {
+			t.Fatalf("operation %d on %s: %v", i, id, err)
+		}
+	}
+
+	list, err := env.tm.List(ctx, Filter{IncludeArchived: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recounted := newTaskCounters(true, env.tm.terminal)
+	recounted.reset(list)
+
+	if got, want := env.tm.stats.snapshot(), recounted.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got counters %+v, want %+v from a recount", got, want)
+	}
+	if !maps.Equal(env.tm.stats.titles, recounted.titles) {
+		t.Fatalf("got title counts %v, want %v from a recount", env.tm.stats.titles, recounted.titles)
+	}
+}
+
+// countingCounts is a storage that counts the calls to Count
+type countingCounts struct {
+	storage.Storage
+	calls atomic.Int64
+}
+
+func (s *countingCounts) Count(ctx context.Context) (int, error) {
+	s.calls.Add(1)
+	return s.Storage.Count(ctx)
+}
+
+func TestStatsDoNotCountStorage(t *testing.T) {
+	env := newTestEnv(t)
+	counting := &countingCounts{Storage: env.storage}
+	env.tm.storage = counting
+
+	env.mustCreate(t, CreateParams{Title: "counted"})
+	for range 10 {
+		if _, err := env.tm.GetStats(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := counting.calls.Load(); calls != 0 {
+		t.Fatalf("storage was counted %d times", calls)
+	}
+}
+
+func TestStatsRecountAfterEviction(t *testing.T) {
+	const capacity = 3
+	env := newTestEnvHive(t, func(h *hive.Hive) {
+		hive.AddConfigOverride(h, func(cfg *storage.Config) {
+			cfg.MaxItems = capacity
+			cfg.FullBehavior = storage.FullEvict
+		})
+	})
+
+	for i := range capacity + 2 {
+		env.mustCreate(t, CreateParams{Title: fmt.Sprintf("task %d", i)})
+	}
+	env.expectStats(t, capacity, 0, 0, map[string]int{StatusPending: capacity})
+}
@@ -1,14 +1,31 @@
 package tasks
 
 import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bhargavparmar/hive-demo/pkg/clock"
+	"github.com/bhargavparmar/hive-demo/pkg/idgen"
 	"github.com/bhargavparmar/hive-demo/pkg/metrics"
 	"github.com/bhargavparmar/hive-demo/pkg/storage"
+	"github.com/bhargavparmar/hive-demo/pkg/webhooks"
 	"github.com/cilium/hive/cell"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Cell provides task management business logic
@@ -16,114 +33,785 @@ var Cell = cell.Module(
 	"tasks",
 	"Task Management",
 
-	cell.Provide(newTaskManager),
+	cell.Config(defaultConfig),
+	metrics.TimeHooks(
+		cell.Provide(newTaskManager),
+	),
 )
 
+// Config holds task management configuration
+type Config struct {
+	MaxTitleLength        int `mapstructure:"task-max-title-len"`
+	MaxDescriptionLength  int `mapstructure:"task-max-desc-len"`
+	CreateRatePerAssignee int `mapstructure:"task-create-rate-per-assignee"`
+
+	MaxOpenPerAssignee          int            `mapstructure:"task-max-open-per-assignee"`
+	MaxOpenPerAssigneeOverrides map[string]int `mapstructure:"task-max-open-per-assignee-overrides"`
+
+	Statuses      []string `mapstructure:"task-statuses"`
+	DefaultStatus string   `mapstructure:"task-default-status"`
+	// TerminalStatuses are the statuses of finished tasks, which never
+	// count as open and get no reminders. Each must be one of Statuses.
+	TerminalStatuses []string `mapstructure:"task-terminal-statuses"`
+
+	// ReminderLeadTime is how long before their due date tasks are
+	// announced with EventDueSoon, 0 for no reminders
+	ReminderLeadTime time.Duration `mapstructure:"task-reminder-lead-time"`
+
+	// UniqueTitles rejects writes that would give two tasks the same title
+	UniqueTitles bool `mapstructure:"task-unique-titles"`
+
+	// UpsertCreateMissing makes Upsert create tasks with IDs that are not
+	// in use, rather than failing them as not found
+	UpsertCreateMissing bool `mapstructure:"task-upsert-create-missing"`
+}
+
+var defaultConfig = Config{
+	MaxTitleLength:        200,
+	MaxDescriptionLength:  5000,
+	CreateRatePerAssignee: 0,
+
+	MaxOpenPerAssignee:          0,
+	MaxOpenPerAssigneeOverrides: map[string]int{},
+
+	Statuses:         []string{StatusPending, StatusInProgress, StatusCompleted, StatusCancelled},
+	DefaultStatus:    "",
+	TerminalStatuses: []string{StatusCompleted, StatusCancelled},
+
+	ReminderLeadTime: time.Hour,
+
+	UniqueTitles:        false,
+	UpsertCreateMissing: false,
+}
+
+// Flags implements cell.Flagger
+func (c Config) Flags(flags *pflag.FlagSet) {
+	flags.Int("task-max-title-len", c.MaxTitleLength, "Maximum task title length in characters")
+	flags.Int("task-max-desc-len", c.MaxDescriptionLength, "Maximum task description length in characters")
+	flags.Int("task-create-rate-per-assignee", c.CreateRatePerAssignee, "Maximum tasks created per minute for a single assignee (0 disables)")
+	flags.Int("task-max-open-per-assignee", c.MaxOpenPerAssignee, "Maximum open tasks, those not in one of --task-terminal-statuses, for a single assignee (0 disables)")
+	flags.StringSlice("task-statuses", c.Statuses, "Allowed task statuses in lifecycle order")
+	flags.String("task-default-status", c.DefaultStatus, "Status of tasks created without one; must be one of --task-statuses (empty uses the first)")
+	flags.StringSlice("task-terminal-statuses", c.TerminalStatuses, "Statuses of finished tasks, which never count as open and get no reminders; each must be one of --task-statuses")
+	flags.StringToInt("task-max-open-per-assignee-overrides", c.MaxOpenPerAssigneeOverrides, "Per-assignee open task limits that replace --task-max-open-per-assignee, e.g. alice=10,bob=0 (0 disables)")
+	flags.Duration("task-reminder-lead-time", c.ReminderLeadTime, "How long before its due date an open task is announced with a task.due_soon webhook event (0 disables)")
+	flags.Bool("task-unique-titles", c.UniqueTitles, "Reject creating or renaming a task to the exact title of another task, archived or not, with 409 Conflict")
+	flags.Bool("task-upsert-create-missing", c.UpsertCreateMissing, "Create tasks given to POST /tasks/upsert with an ID that does not exist, instead of failing them as not found")
+}
+
 // Task represents a task in the system
 type Task struct {
 	ID          string    `json:"id"`
 	Title       string    `json:"title"`
-	Description string    `json:"description"`
+	Description string    `json:"description,omitempty"`
 	Status      string    `json:"status"`
+	Assignee    string    `json:"assignee,omitempty"`
+	Archived    bool      `json:"archived,omitempty"`
+	Starred     bool      `json:"starred,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Labels are key/value metadata such as team=payments
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// EstimateMinutes is the expected effort, 0 if not estimated, and
+	// SpentMinutes the effort spent so far
+	EstimateMinutes int `json:"estimate_minutes,omitempty"`
+	SpentMinutes    int `json:"spent_minutes,omitempty"`
+
+	// Order is the manual position of the task within its status, lowest
+	// first. New tasks go after the existing ones.
+	Order float64 `json:"order"`
+
+	// Watchers follow the task's changes through the webhook events, which
+	// carry them. WatcherCount is their number.
+	Watchers     []string `json:"watchers,omitempty"`
+	WatcherCount int      `json:"watcher_count"`
+
+	// ClaimedBy is the worker that claimed the task until ClaimExpiresAt.
+	// An expired claim is kept until the task is claimed or released again.
+	ClaimedBy      string     `json:"claimed_by,omitempty"`
+	ClaimExpiresAt *time.Time `json:"claim_expires_at,omitempty"`
+
+	// DueAt is when the task should be done, nil if it has no due date
+	DueAt *time.Time `json:"due_at,omitempty"`
+}
+
+// Default task statuses. The allowed statuses are configurable, as are the
+// terminal ones, completed and cancelled by default, that never count as
+// open.
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusCancelled  = "cancelled"
+)
+
+// Webhook event types published when a task changes. The event data is the
+// task after the change, or before it for deletions.
+const (
+	EventCreated    = "task.created"
+	EventUpdated    = "task.updated"
+	EventArchived   = "task.archived"
+	EventUnarchived = "task.unarchived"
+	EventDeleted    = "task.deleted"
+	// EventDueSoon is published once for an open task when its due date
+	// is less than the reminder lead time away
+	EventDueSoon = "task.due_soon"
+)
+
+// Errors returned by the task manager
+var (
+	ErrTitleRequired = errors.New("title is required")
+	ErrTaskNotFound  = errors.New("task not found")
+	ErrInvalidStatus = errors.New("invalid status")
+	ErrInvalidPatch  = errors.New("invalid merge patch")
+	ErrInvalidBatch  = errors.New("invalid batch")
+
+	// ErrIDCollision is returned when a generated ID is already in use
+	ErrIDCollision = errors.New("task ID collision")
+	// ErrRateLimited is returned when an assignee creates tasks too quickly
+	ErrRateLimited = errors.New("task creation rate limit exceeded")
+	// ErrOpenLimit is returned when a write would give an assignee more open
+	// tasks than they are allowed
+	ErrOpenLimit = errors.New("open task limit exceeded")
+	// ErrVersionMismatch is returned when a task no longer has the version
+	// the caller expected
+	ErrVersionMismatch = errors.New("task has been modified")
+)
+
+// CreateParams holds the caller-supplied fields of a new task
+type CreateParams struct {
+	Title       string
+	Description string
+	Assignee    string
+	Labels      map[string]string
+	// Status is the initial status, the configured default if empty
+	Status string
+
+	EstimateMinutes int
+	SpentMinutes    int
+
+	DueAt *time.Time
+}
+
+// MaxBatchSize is the largest number of tasks a batch operation accepts
+const MaxBatchSize = 1000
+
+// BatchResult is the outcome of a batch operation for one task. Task is set
+// on success and Err on failure. Created is set when the task is new.
+type BatchResult struct {
+	ID      string
+	Task    *Task
+	Err     error
+	Created bool
+}
+
+// Filter selects a subset of tasks. Zero-valued fields match every task,
+// except that archived tasks are excluded unless IncludeArchived is set.
+type Filter struct {
+	Status          string
+	IncludeArchived bool
+	// LabelKey selects tasks with this label. If LabelValue is also set the
+	// label must have that value.
+	LabelKey   string
+	LabelValue string
+	// Starred, if not nil, selects the starred or the unstarred tasks
+	Starred *bool
+}
+
+// matchesAll reports whether the filter matches every task
+func (f Filter) matchesAll() bool {
+	return f == Filter{IncludeArchived: true}
+}
+
+func (f Filter) matches(task *Task) bool {
+	if task.Archived && !f.IncludeArchived {
+		return false
+	}
+	if f.Starred != nil && task.Starred != *f.Starred {
+		return false
+	}
+	if f.LabelKey != "" {
+		value, ok := task.Labels[f.LabelKey]
+		if !ok || (f.LabelValue != "" && value != f.LabelValue) {
+			return false
+		}
+	}
+	return f.Status == "" || task.Status == f.Status
+}
+
+// TimeRange restricts tasks by their timestamps. Bounds are exclusive and
+// zero-valued bounds are ignored.
+type TimeRange struct {
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+}
+
+func (r TimeRange) contains(task *Task) bool {
+	created := task.CreatedAt.UTC()
+	updated := task.UpdatedAt.UTC()
+
+	if !r.CreatedAfter.IsZero() && !created.After(r.CreatedAfter.UTC()) {
+		return false
+	}
+	if !r.CreatedBefore.IsZero() && !created.Before(r.CreatedBefore.UTC()) {
+		return false
+	}
+	if !r.UpdatedAfter.IsZero() && !updated.After(r.UpdatedAfter.UTC()) {
+		return false
+	}
+	if !r.UpdatedBefore.IsZero() && !updated.Before(r.UpdatedBefore.UTC()) {
+		return false
+	}
+	return true
 }
 
 // TaskManager manages tasks
 type TaskManager interface {
-	Create(title, description string) (*Task, error)
-	Get(id string) (*Task, error)
-	List() []*Task
-	Update(id string, title, description, status string) (*Task, error)
-	Delete(id string) error
-	GetStats() map[string]interface{}
+	Create(ctx context.Context, params CreateParams) (*Task, error)
+	Get(ctx context.Context, id string) (*Task, error)
+	// List returns the tasks matching the filter, oldest first
+	List(ctx context.Context, filter Filter) ([]*Task, error)
+	// ListByLabel returns the unarchived tasks whose label key has the given
+	// value, or that have the label at all if value is empty
+	ListByLabel(ctx context.Context, key, value string) ([]*Task, error)
+	ListInRange(ctx context.Context, filter Filter, r TimeRange) ([]*Task, error)
+	Count(ctx context.Context, filter Filter) (int, error)
+	// Update changes the given fields of a task: non-empty strings and
+	// non-nil labels, estimate and spent
+	Update(ctx context.Context, id string, title, description, status string, labels map[string]string, estimate, spent *int, dryRun bool) (*Task, error)
+	Patch(ctx context.Context, id string, patch []byte, dryRun bool) (*Task, error)
+	Archive(ctx context.Context, id string) (*Task, error)
+	Unarchive(ctx context.Context, id string) (*Task, error)
+	Star(ctx context.Context, id string) (*Task, error)
+	// Reorder moves a task to directly after afterID within its status,
+	// or to the top if afterID is empty
+	Reorder(ctx context.Context, id, afterID string) (*Task, error)
+	// SetOrders sets the order of several tasks, changing none unless all
+	// exist, and returns them in their new order
+	SetOrders(ctx context.Context, orders map[string]float64) ([]*Task, error)
+	Unstar(ctx context.Context, id string) (*Task, error)
+	// Watch and Unwatch add and remove a watcher of a task
+	Watch(ctx context.Context, id, watcher string) (*Task, error)
+	Unwatch(ctx context.Context, id, watcher string) (*Task, error)
+	// Claim gives a worker exclusive use of a task for ttl and reports
+	// whether it succeeded; Release ends the claim early
+	Claim(ctx context.Context, id, worker string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, id, worker string) error
+	Delete(ctx context.Context, id string, versions []string, dryRun bool) error
+	UpdateStatusBatch(ctx context.Context, ids []string, status string) ([]BatchResult, error)
+	// Upsert creates the tasks without an ID and replaces the fields of
+	// those with one, each succeeding or failing on its own
+	Upsert(ctx context.Context, items []*Task) ([]BatchResult, error)
+	ImportCSV(ctx context.Context, r io.Reader) (ImportResult, error)
+	GetStats(ctx context.Context) (map[string]interface{}, error)
+	// Effort sums the estimated and spent time of the unarchived tasks of
+	// an assignee, or of all of them if assignee is empty
+	Effort(ctx context.Context, assignee string) (Effort, error)
+	// TimeSeries counts tasks by their created or updated timestamp in
+	// buckets of interval between from and to, zero-filled
+	TimeSeries(ctx context.Context, field string, interval time.Duration, from, to time.Time) ([]Bucket, error)
+	// Duplicate creates a new task from the title, description and labels
+	// of an existing one
+	Duplicate(ctx context.Context, id string) (*Task, error)
+	// Clear deletes every task and returns how many were deleted. It waits
+	// for the writes in progress and holds off new ones until done. No
+	// task.deleted webhooks are sent.
+	Clear(ctx context.Context) (int, error)
+	// Facets counts the unarchived tasks by each status, assignee and
+	// label value in use, keyed by field
+	Facets(ctx context.Context) (map[string]map[string]int, error)
+	// Validate checks a task without storing it, returning its warnings and
+	// a *ValidationError if it is invalid
+	Validate(task *Task) ([]Warning, error)
+	// ValidateBatch validates the tasks Create would build from each of
+	// params, without storing them
+	ValidateBatch(ctx context.Context, params []CreateParams) ([]ValidationResult, error)
+	// Autocomplete suggests up to limit titles of unarchived tasks that
+	// match query, best matches first
+	Autocomplete(ctx context.Context, query string, limit int) ([]string, error)
+	// ListVersion identifies the current state of the task list. It changes
+	// whenever a task is created, changed or deleted through this task
+	// manager, and differs between runs.
+	ListVersion() string
+	// ReserveIDs keeps Upsert from creating tasks with the given IDs, such
+	// as the fixed paths the API serves under /tasks/
+	ReserveIDs(ids ...string)
+	// SetCreateRatePerAssignee replaces the per-assignee create rate limit
+	// while running, with 0 disabling it. Every assignee starts over with a
+	// full allowance.
+	SetCreateRatePerAssignee(limit int) error
 }
 
 type taskManager struct {
+	cfg     Config
 	logger  *slog.Logger
 	storage storage.Storage
 	metrics metrics.Metrics
+	ids     idgen.Generator
+	clock   clock.Clock
+	hooks   webhooks.Dispatcher
+	// limiter is nil when creation is not rate limited. It is replaced
+	// when the limit is reloaded.
+	limiter atomic.Pointer[assigneeLimiter]
+	stats   *taskCounters
+	// evictions is the storage's eviction count when the counters were
+	// last recounted, and countersStale is set when a write may have
+	// changed the storage without updating the counters
+	evictions     atomic.Uint64
+	countersStale atomic.Bool
+	tracer        trace.Tracer
+	// openMu is held while checking the open task limit and storing the
+	// task, nil when no limit is configured
+	openMu *sync.Mutex
+	// titleMu is held while checking that the title is unique and storing
+	// the task, nil unless titles must be unique. It is taken before openMu.
+	titleMu *sync.Mutex
+	// statuses is the set of allowed statuses and defaultStatus the one
+	// new tasks get unless they ask for another. terminal is the set of
+	// statuses of finished tasks.
+	statuses      map[string]bool
+	defaultStatus string
+	terminal      map[string]bool
+	// locks serializes writes to the same task. It is taken before titleMu
+	// and openMu.
+	locks *keyLocks
+	// orderMu serializes moves. It is taken before locks.
+	orderMu sync.Mutex
+
+	// reserved are the IDs Upsert does not create, set with ReserveIDs
+	reservedMu sync.RWMutex
+	reserved   map[string]bool
+
+	// epoch and version make up the list version: epoch tells runs apart
+	// and version counts the writes of this run
+	epoch   string
+	version atomic.Uint64
+
+	// stopReminders stops sending reminders, nil when they are not being
+	// sent
+	stopReminders func()
+	remindersDone chan struct{}
 }
 
 // newTaskManager creates a new task manager with dependencies
-func newTaskManager(lc cell.Lifecycle, logger *slog.Logger, storage storage.Storage, metrics metrics.Metrics) TaskManager {
+func newTaskManager(lc cell.Lifecycle, cfg Config, logger *slog.Logger, storage storage.Storage, metrics metrics.Metrics, ids idgen.Generator, clk clock.Clock, hooks webhooks.Dispatcher, tp trace.TracerProvider) (TaskManager, error) {
+	if cfg.MaxTitleLength <= 0 {
+		return nil, fmt.Errorf("task-max-title-len must be positive, got %d", cfg.MaxTitleLength)
+	}
+	if cfg.MaxDescriptionLength <= 0 {
+		return nil, fmt.Errorf("task-max-desc-len must be positive, got %d", cfg.MaxDescriptionLength)
+	}
+	if cfg.ReminderLeadTime < 0 {
+		return nil, fmt.Errorf("task-reminder-lead-time must not be negative, got %s", cfg.ReminderLeadTime)
+	}
+	if cfg.MaxOpenPerAssignee < 0 {
+		return nil, fmt.Errorf("task-max-open-per-assignee must not be negative, got %d", cfg.MaxOpenPerAssignee)
+	}
+	statuses, err := statusSet(cfg.Statuses)
+	if err != nil {
+		return nil, err
+	}
+	defaultStatus := cmp.Or(cfg.DefaultStatus, cfg.Statuses[0])
+	if !statuses[defaultStatus] {
+		return nil, fmt.Errorf("task-default-status %s is not one of task-statuses (%s)", defaultStatus, strings.Join(cfg.Statuses, ", "))
+	}
+	terminal, err := terminalSet(cfg.TerminalStatuses, statuses)
+	if err != nil {
+		return nil, err
+	}
+	for assignee, limit := range cfg.MaxOpenPerAssigneeOverrides {
+		if limit < 0 {
+			return nil, fmt.Errorf("task-max-open-per-assignee-overrides: limit for %s must not be negative, got %d", assignee, limit)
+		}
+	}
+
 	tm := &taskManager{
+		cfg:     cfg,
 		logger:  logger.With("component", "task-manager"),
 		storage: storage,
 		metrics: metrics,
+		ids:     ids,
+		clock:   clk,
+		hooks:   hooks,
+		tracer:  tp.Tracer("tasks"),
+		stats:   newTaskCounters(cfg.UniqueTitles, terminal),
+
+		statuses:      statuses,
+		defaultStatus: defaultStatus,
+		terminal:      terminal,
+		reserved:      make(map[string]bool),
+		locks:         newKeyLocks(),
+		epoch:         strconv.FormatInt(clk.Now().UnixNano(), 36),
+	}
+
+	if err := tm.SetCreateRatePerAssignee(cfg.CreateRatePerAssignee); err != nil {
+		return nil, err
+	}
+	if cfg.MaxOpenPerAssignee > 0 || len(cfg.MaxOpenPerAssigneeOverrides) > 0 {
+		tm.openMu = new(sync.Mutex)
+	}
+	if cfg.UniqueTitles {
+		tm.titleMu = new(sync.Mutex)
 	}
 
 	lc.Append(cell.Hook{
 		OnStart: func(ctx cell.HookContext) error {
+			if err := tm.recount(ctx); err != nil {
+				return err
+			}
+			if cfg.ReminderLeadTime > 0 {
+				if err := tm.startReminders(ctx); err != nil {
+					return err
+				}
+			}
 			tm.logger.Info("Task manager started")
 			return nil
 		},
 		OnStop: func(ctx cell.HookContext) error {
-			count := tm.storage.Count()
+			if tm.stopReminders != nil {
+				tm.stopReminders()
+				<-tm.remindersDone
+			}
+			count, err := tm.storage.Count(ctx)
+			if err != nil {
+				return err
+			}
 			tm.logger.Info("Task manager stopping", "active_tasks", count)
 			return nil
 		},
 	})
 
-	return tm
+	return tm, nil
+}
+
+func (tm *taskManager) Create(ctx context.Context, params CreateParams) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Create")
+	defer span.End()
+
+	now := tm.clock.Now()
+	task := tm.newTask(params, now)
+	task.ID = "task-" + tm.ids.NewID()
+
+	// A generator producing IDs that could not be fetched again is a bug
+	if err := ValidateID(task.ID); err != nil {
+		tm.metrics.IncrementErrorsByType(metrics.ErrorInternal)
+		tm.logger.Error("Generated task ID is invalid", "id", task.ID)
+		return nil, fmt.Errorf("generated task ID: %v", err)
+	}
+
+	// Like every write, hold the task's lock so that Clear waits for it
+	defer tm.locks.lock(task.ID)()
+	return tm.insert(ctx, task, now)
 }
 
-func (tm *taskManager) Create(title, description string) (*Task, error) {
-	if title == "" {
-		tm.metrics.IncrementErrors()
-		return nil, errors.New("title is required")
+// insert validates and stores a new task with its ID already set, unless a
+// task with that ID exists. The caller must hold the ID's key lock.
+func (tm *taskManager) insert(ctx context.Context, task *Task, now time.Time) (*Task, error) {
+	if err := tm.validate(ctx, task); err != nil {
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, err
+	}
+
+	defer tm.lockUniqueTitles()()
+	if err := tm.checkUniqueTitle(ctx, nil, task); err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return nil, err
+	}
+
+	defer tm.lockOpenLimit()()
+	if err := tm.checkOpenLimit(ctx, nil, task); err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return nil, err
 	}
 
-	task := &Task{
-		ID:          fmt.Sprintf("task-%d", time.Now().UnixNano()),
-		Title:       title,
-		Description: description,
-		Status:      "pending",
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	// Checked last, so a create rejected for another reason does not use
+	// up the assignee's allowance. Unassigned tasks are not rate limited.
+	if limiter := tm.limiter.Load(); limiter != nil && task.Assignee != "" && !limiter.Allow(task.Assignee, now) {
+		tm.metrics.IncrementErrorsByType(metrics.ErrorRateLimited)
+		tm.logger.Warn("Task creation rate limited", "assignee", task.Assignee)
+		return nil, fmt.Errorf("%w for assignee %s", ErrRateLimited, task.Assignee)
 	}
 
-	tm.storage.Set(task.ID, task)
+	// Never overwrite an existing task, even if the generator repeats an ID
+	stored, err := tm.storage.SetIfAbsent(ctx, task.ID, task)
+	if err != nil {
+		return nil, err
+	}
+	if !stored {
+		tm.metrics.IncrementErrorsByType(metrics.ErrorInternal)
+		tm.logger.Error("Task ID collision", "id", task.ID)
+		return nil, fmt.Errorf("%w: %s", ErrIDCollision, task.ID)
+	}
+	tm.stats.add(task, 1)
+	tm.version.Add(1)
 	tm.logger.Info("Task created", "id", task.ID, "title", task.Title)
+	tm.hooks.Publish(EventCreated, task)
+
+	return task, nil
+}
+
+// newTask builds a task from create parameters, without an ID
+func (tm *taskManager) newTask(params CreateParams, now time.Time) *Task {
+	return &Task{
+		Title:       params.Title,
+		Description: params.Description,
+		Status:      cmp.Or(params.Status, tm.defaultStatus),
+		Assignee:    params.Assignee,
+		Labels:      maps.Clone(params.Labels),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+
+		EstimateMinutes: params.EstimateMinutes,
+		SpentMinutes:    params.SpentMinutes,
+		DueAt:           params.DueAt,
 
+		// Creation order until the task is moved; the millisecond
+		// timestamp exceeds any order a rebalance hands out
+		Order: float64(now.UnixMilli()),
+	}
+}
+
+func (tm *taskManager) Get(ctx context.Context, id string) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Get")
+	defer span.End()
+
+	task, err := tm.load(ctx, id)
+	if err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return nil, err
+	}
 	return task, nil
 }
 
-func (tm *taskManager) Get(id string) (*Task, error) {
-	val, ok := tm.storage.Get(id)
+// load fetches a task from storage without recording metrics. A stored
+// value that is not a task is deleted and reported as not found, so a
+// corrupt entry does not fail every request for its ID.
+func (tm *taskManager) load(ctx context.Context, id string) (*Task, error) {
+	if err := ValidateID(id); err != nil {
+		return nil, err
+	}
+
+	val, ok, err := tm.storage.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 	if !ok {
-		tm.metrics.IncrementErrors()
-		return nil, errors.New("task not found")
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, id)
 	}
 
-	task, ok := val.(*Task)
+	task, ok := asTask(val)
 	if !ok {
-		tm.metrics.IncrementErrors()
-		return nil, errors.New("invalid task data")
+		tm.dropCorrupt(ctx, id, val)
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, id)
 	}
 
 	return task, nil
 }
 
-func (tm *taskManager) List() []*Task {
-	all := tm.storage.List()
+// dropCorrupt deletes a stored value that is not a task. No key lock is
+// needed: tasks are only stored under a free key or over a valid task, so
+// no write can replace the value before it is deleted.
+func (tm *taskManager) dropCorrupt(ctx context.Context, id string, val interface{}) {
+	tm.logger.Error("Deleting invalid task data", "id", id, "type", fmt.Sprintf("%T", val))
+	if err := tm.storage.Delete(ctx, id); err != nil {
+		tm.logger.Error("Failed to delete invalid task data", "id", id, "error", err)
+		return
+	}
+	tm.version.Add(1)
+}
+
+// countError records a failed operation unless it was a dry run
+func (tm *taskManager) countError(err error, dryRun bool) {
+	if !dryRun {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+	}
+}
+
+// ErrorType classifies an error returned by the task manager into one of the
+// metrics error categories
+func ErrorType(err error) string {
+	switch {
+	case errors.Is(err, ErrValidation),
+		errors.Is(err, ErrTitleRequired),
+		errors.Is(err, ErrInvalidStatus),
+		errors.Is(err, ErrInvalidPatch),
+		errors.Is(err, ErrInvalidBatch),
+		errors.Is(err, ErrInvalidImport),
+		errors.Is(err, ErrInvalidAutocomplete),
+		errors.Is(err, ErrInvalidID),
+		errors.Is(err, ErrInvalidMove),
+		errors.Is(err, ErrInvalidWatcher),
+		errors.Is(err, ErrInvalidClaim),
+		errors.Is(err, ErrInvalidTimeSeries):
+		return metrics.ErrorValidation
+	case errors.Is(err, ErrTaskNotFound):
+		return metrics.ErrorNotFound
+	case errors.Is(err, ErrRateLimited):
+		return metrics.ErrorRateLimited
+	case errors.Is(err, ErrOpenLimit),
+		errors.Is(err, ErrDuplicateTitle),
+		errors.Is(err, ErrVersionMismatch),
+		errors.Is(err, ErrClaimHeld):
+		return metrics.ErrorConflict
+	case errors.Is(err, context.DeadlineExceeded):
+		return metrics.ErrorTimeout
+	default:
+		return metrics.ErrorInternal
+	}
+}
+
+// Version identifies the current contents of a task. It changes whenever
+// any field changes.
+func (t *Task) Version() string {
+	data, err := json.Marshal(t)
+	if err != nil {
+		// A Task always marshals
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// asTask converts a stored value to a task. Serializing storage backends
+// return the encoded task rather than the stored *Task.
+func asTask(val interface{}) (*Task, bool) {
+	switch v := val.(type) {
+	case *Task:
+		return v, true
+	case storage.Encoded:
+		var task Task
+		if err := v.Decode(&task); err != nil {
+			return nil, false
+		}
+		return &task, true
+	default:
+		return nil, false
+	}
+}
+
+// listed converts a value listed from storage to a task, logging values
+// that are not tasks so they can be told apart from filtered ones. They are
+// left in place; reading the task by ID deletes them.
+func (tm *taskManager) listed(id string, val interface{}) (*Task, bool) {
+	task, ok := asTask(val)
+	if !ok {
+		tm.logger.Error("Skipping invalid task data", "id", id, "type", fmt.Sprintf("%T", val))
+	}
+	return task, ok
+}
+
+func (tm *taskManager) List(ctx context.Context, filter Filter) ([]*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.List")
+	defer span.End()
+
+	if err := tm.validateFilter(filter); err != nil {
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, err
+	}
+
+	all, err := tm.storage.List(ctx)
+	if err != nil {
+		return nil, err
+	}
 	tasks := make([]*Task, 0, len(all))
 
-	for _, val := range all {
-		if task, ok := val.(*Task); ok {
+	for id, val := range all {
+		if task, ok := tm.listed(id, val); ok && filter.matches(task) {
 			tasks = append(tasks, task)
 		}
 	}
 
-	return tasks
+	// Storage iteration order is random; list oldest first so repeated
+	// calls agree
+	slices.SortFunc(tasks, compareCreated)
+
+	return tasks, nil
+}
+
+func (tm *taskManager) ListByLabel(ctx context.Context, key, value string) ([]*Task, error) {
+	return tm.List(ctx, Filter{LabelKey: key, LabelValue: value})
+}
+
+// compareCreated orders tasks by creation time, then by ID
+func compareCreated(a, b *Task) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// ListInRange lists the tasks matching the filter whose timestamps fall
+// within the time range
+func (tm *taskManager) ListInRange(ctx context.Context, filter Filter, r TimeRange) ([]*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.ListInRange")
+	defer span.End()
+
+	tasks, err := tm.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	inRange := tasks[:0]
+	for _, task := range tasks {
+		if r.contains(task) {
+			inRange = append(inRange, task)
+		}
+	}
+
+	return inRange, nil
+}
+
+// Count returns the number of tasks matching the filter. Unfiltered counts
+// come straight from the storage without listing it.
+func (tm *taskManager) Count(ctx context.Context, filter Filter) (int, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Count")
+	defer span.End()
+
+	if err := tm.validateFilter(filter); err != nil {
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return 0, err
+	}
+
+	if filter.matchesAll() {
+		return tm.storage.Count(ctx)
+	}
+
+	all, err := tm.storage.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for id, val := range all {
+		if task, ok := tm.listed(id, val); ok && filter.matches(task) {
+			count++
+		}
+	}
+
+	return count, nil
 }
 
-func (tm *taskManager) Update(id string, title, description, status string) (*Task, error) {
-	task, err := tm.Get(id)
+// Update changes the non-empty fields of a task. Non-nil labels replace all
+// of the task's labels, and a non-nil estimate or spent replaces the
+// task's, so they can be reset to 0. With dryRun set the updated task is
+// validated and returned but not stored.
+func (tm *taskManager) Update(ctx context.Context, id string, title, description, status string, labels map[string]string, estimate, spent *int, dryRun bool) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Update")
+	defer span.End()
+	defer tm.locks.lock(id)()
+
+	current, err := tm.load(ctx, id)
 	if err != nil {
+		tm.countError(err, dryRun)
 		return nil, err
 	}
 
+	// Work on a copy so a rejected update leaves the stored task untouched
+	task := *current
 	if title != "" {
 		task.Title = title
 	}
@@ -133,40 +821,401 @@ func (tm *taskManager) Update(id string, title, description, status string) (*Ta
 	if status != "" {
 		task.Status = status
 	}
-	task.UpdatedAt = time.Now()
+	if labels != nil {
+		task.Labels = maps.Clone(labels)
+	}
+	if estimate != nil {
+		task.EstimateMinutes = *estimate
+	}
+	if spent != nil {
+		task.SpentMinutes = *spent
+	}
+	task.UpdatedAt = tm.clock.Now()
+
+	if err := tm.validate(ctx, &task); err != nil {
+		tm.countError(err, dryRun)
+		return nil, err
+	}
+
+	defer tm.lockUniqueTitles()()
+	if err := tm.checkUniqueTitle(ctx, current, &task); err != nil {
+		tm.countError(err, dryRun)
+		return nil, err
+	}
+
+	defer tm.lockOpenLimit()()
+	if err := tm.checkOpenLimit(ctx, current, &task); err != nil {
+		tm.countError(err, dryRun)
+		return nil, err
+	}
 
-	tm.storage.Set(id, task)
+	if dryRun {
+		return &task, nil
+	}
+
+	if err := tm.storage.Set(ctx, id, &task); err != nil {
+		return nil, err
+	}
+	tm.stats.replace(current, &task)
+	tm.version.Add(1)
 	tm.logger.Info("Task updated", "id", task.ID)
+	tm.hooks.Publish(EventUpdated, &task)
 
-	return task, nil
+	return &task, nil
+}
+
+// Patch applies an RFC 7386 JSON merge patch to a task. Members set to null
+// are removed, which clears the corresponding field. The ID, creation time
+// and claim cannot be changed and the patched task must still be valid. With dryRun set
+// the patched task is returned but not stored.
+func (tm *taskManager) Patch(ctx context.Context, id string, patch []byte, dryRun bool) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Patch")
+	defer span.End()
+	defer tm.locks.lock(id)()
+
+	task, err := tm.load(ctx, id)
+	if err != nil {
+		tm.countError(err, dryRun)
+		return nil, err
+	}
+
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		tm.countError(err, dryRun)
+		return nil, err
+	}
+	if _, ok := p.(map[string]interface{}); !ok {
+		err := fmt.Errorf("%w: must be a JSON object", ErrInvalidPatch)
+		tm.countError(err, dryRun)
+		return nil, err
+	}
+
+	current, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return nil, err
+	}
+
+	merged, err := json.Marshal(mergePatch(doc, p))
+	if err != nil {
+		return nil, err
+	}
+
+	var patched Task
+	if err := json.Unmarshal(merged, &patched); err != nil {
+		tm.countError(err, dryRun)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	patched.ID = task.ID
+	patched.CreatedAt = task.CreatedAt
+	patched.setWatchers(patched.Watchers)
+	patched.ClaimedBy, patched.ClaimExpiresAt = task.ClaimedBy, task.ClaimExpiresAt
+	patched.UpdatedAt = tm.clock.Now()
+
+	if err := tm.validate(ctx, &patched); err != nil {
+		tm.countError(err, dryRun)
+		return nil, err
+	}
+
+	defer tm.lockUniqueTitles()()
+	if err := tm.checkUniqueTitle(ctx, task, &patched); err != nil {
+		tm.countError(err, dryRun)
+		return nil, err
+	}
+
+	defer tm.lockOpenLimit()()
+	if err := tm.checkOpenLimit(ctx, task, &patched); err != nil {
+		tm.countError(err, dryRun)
+		return nil, err
+	}
+
+	if dryRun {
+		return &patched, nil
+	}
+
+	if err := tm.storage.Set(ctx, id, &patched); err != nil {
+		return nil, err
+	}
+	tm.stats.replace(task, &patched)
+	tm.version.Add(1)
+	tm.logger.Info("Task patched", "id", id)
+	tm.hooks.Publish(EventUpdated, &patched)
+
+	return &patched, nil
+}
+
+// UpdateStatusBatch sets the status of every listed task. The status is
+// validated once up front; a task that cannot be updated is reported in its
+// result and does not stop the rest of the batch.
+func (tm *taskManager) UpdateStatusBatch(ctx context.Context, ids []string, status string) ([]BatchResult, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.UpdateStatusBatch")
+	defer span.End()
+
+	switch {
+	case len(ids) == 0:
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, fmt.Errorf("%w: no task IDs given", ErrInvalidBatch)
+	case len(ids) > MaxBatchSize:
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, fmt.Errorf("%w: at most %d task IDs allowed, got %d", ErrInvalidBatch, MaxBatchSize, len(ids))
+	case !tm.statuses[status]:
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, fmt.Errorf("%w: %s", ErrInvalidStatus, status)
+	}
+
+	results := make([]BatchResult, len(ids))
+	updated := 0
+	for i, id := range ids {
+		task, err := tm.Update(ctx, id, "", "", status, nil, nil, nil, false)
+		results[i] = BatchResult{ID: id, Task: task, Err: err}
+		if err == nil {
+			updated++
+		}
+	}
+	tm.logger.Info("Task statuses updated", "status", status, "updated", updated, "failed", len(ids)-updated)
+
+	return results, nil
+}
+
+// mergePatch implements the MergePatch algorithm from RFC 7386
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+		t[name] = mergePatch(t[name], value)
+	}
+
+	return t
+}
+
+// Archive hides a task from listings without deleting it
+func (tm *taskManager) Archive(ctx context.Context, id string) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Archive")
+	defer span.End()
+
+	return tm.setArchived(ctx, id, true)
+}
+
+// Unarchive makes an archived task visible in listings again
+func (tm *taskManager) Unarchive(ctx context.Context, id string) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Unarchive")
+	defer span.End()
+
+	return tm.setArchived(ctx, id, false)
+}
+
+func (tm *taskManager) setArchived(ctx context.Context, id string, archived bool) (*Task, error) {
+	defer tm.locks.lock(id)()
+
+	current, err := tm.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Archived == archived {
+		return current, nil
+	}
+
+	// The memory backend returns the stored task itself, which concurrent
+	// readers may be using, so change a copy
+	task := *current
+	task.Archived = archived
+	task.UpdatedAt = tm.clock.Now()
+
+	if err := tm.storage.Set(ctx, id, &task); err != nil {
+		return nil, err
+	}
+	tm.stats.replace(current, &task)
+	tm.version.Add(1)
+	tm.logger.Info("Task archive state changed", "id", id, "archived", archived)
+	if archived {
+		tm.hooks.Publish(EventArchived, &task)
+	} else {
+		tm.hooks.Publish(EventUnarchived, &task)
+	}
+
+	return &task, nil
+}
+
+// Star marks a task as important so it can be listed with the other starred
+// tasks. Starring a starred task has no effect.
+func (tm *taskManager) Star(ctx context.Context, id string) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Star")
+	defer span.End()
+
+	return tm.setStarred(ctx, id, true)
 }
 
-func (tm *taskManager) Delete(id string) error {
-	_, err := tm.Get(id)
+// Unstar removes the star from a task
+func (tm *taskManager) Unstar(ctx context.Context, id string) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Unstar")
+	defer span.End()
+
+	return tm.setStarred(ctx, id, false)
+}
+
+func (tm *taskManager) setStarred(ctx context.Context, id string, starred bool) (*Task, error) {
+	defer tm.locks.lock(id)()
+
+	current, err := tm.Get(ctx, id)
 	if err != nil {
+		return nil, err
+	}
+
+	if current.Starred == starred {
+		return current, nil
+	}
+
+	task := *current
+	task.Starred = starred
+	task.UpdatedAt = tm.clock.Now()
+
+	if err := tm.storage.Set(ctx, id, &task); err != nil {
+		return nil, err
+	}
+	tm.stats.replace(current, &task)
+	tm.version.Add(1)
+	tm.logger.Info("Task star changed", "id", id, "starred", starred)
+	tm.hooks.Publish(EventUpdated, &task)
+
+	return &task, nil
+}
+
+// Delete removes a task. If versions is not nil the task's current
+// version must be one of them, so a task changed since the caller read it is
+// not deleted. With dryRun set it only checks that the task exists and
+// matches.
+func (tm *taskManager) Delete(ctx context.Context, id string, versions []string, dryRun bool) error {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Delete")
+	defer span.End()
+	defer tm.locks.lock(id)()
+
+	task, err := tm.load(ctx, id)
+	if err != nil {
+		tm.countError(err, dryRun)
+		return err
+	}
+
+	if versions != nil && !slices.Contains(versions, task.Version()) {
+		err := fmt.Errorf("%w: %s", ErrVersionMismatch, id)
+		tm.countError(err, dryRun)
 		return err
 	}
 
-	tm.storage.Delete(id)
+	if dryRun {
+		return nil
+	}
+
+	if err := tm.storage.Delete(ctx, id); err != nil {
+		return err
+	}
+	tm.stats.add(task, -1)
+	tm.version.Add(1)
 	tm.logger.Info("Task deleted", "id", id)
+	tm.hooks.Publish(EventDeleted, task)
 
 	return nil
 }
 
-func (tm *taskManager) GetStats() map[string]interface{} {
-	tasks := tm.List()
+func (tm *taskManager) Clear(ctx context.Context) (int, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Clear")
+	defer span.End()
+
+	// Take every lock a write can hold, in their usual order, so that no
+	// write that loaded a task before the clear stores it again after
+	tm.orderMu.Lock()
+	defer tm.orderMu.Unlock()
+	defer tm.locks.lockAll()()
+	defer tm.lockUniqueTitles()()
+	defer tm.lockOpenLimit()()
+
+	// Even a failed clear may have deleted some tasks, so the counters are
+	// rebuilt by the next stats request
+	count, err := tm.storage.Clear(ctx)
+	tm.stats.reset(nil)
+	tm.version.Add(1)
+	if err != nil {
+		tm.countersStale.Store(true)
+		return count, err
+	}
+	tm.logger.Warn("All tasks deleted", "count", count)
+
+	return count, nil
+}
+
+func (tm *taskManager) ListVersion() string {
+	return tm.epoch + "-" + strconv.FormatUint(tm.version.Load(), 10)
+}
+
+func (tm *taskManager) GetStats(ctx context.Context) (map[string]interface{}, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.GetStats")
+	defer span.End()
+
+	ts, err := tm.taskStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	stats := map[string]interface{}{
-		"total_tasks":    len(tasks),
+		"total_tasks":    ts.total,
+		"archived_tasks": ts.archived,
+		"starred_tasks":  ts.starred,
 		"total_requests": tm.metrics.GetRequests(),
 		"total_errors":   tm.metrics.GetErrors(),
+		"by_error_type":  tm.metrics.GetErrorsByType(),
+		"by_status":      ts.byStatus,
+		"database":       tm.metrics.GetQueryStats(),
+		"cache":          tm.metrics.GetCacheStats(),
+		"startup":        tm.metrics.GetHookDurations(),
+		"effort":         ts.effort,
 	}
 
-	// Count by status
-	statusCount := make(map[string]int)
-	for _, task := range tasks {
-		statusCount[task.Status]++
+	return stats, nil
+}
+
+// taskStats returns the task counters. They are only recounted, listing
+// every task, when they went out of date because the storage evicted tasks
+// or a clear failed part way. Writes by other instances sharing the
+// storage are not tracked.
+func (tm *taskManager) taskStats(ctx context.Context) (taskStats, error) {
+	if tm.countersStale.Load() || tm.storage.Evictions() != tm.evictions.Load() {
+		tm.logger.Debug("Task counters out of date, recounting")
+		if err := tm.recount(ctx); err != nil {
+			return taskStats{}, err
+		}
 	}
-	stats["by_status"] = statusCount
+	return tm.stats.snapshot(), nil
+}
+
+// recount rebuilds the task counters from storage
+func (tm *taskManager) recount(ctx context.Context) error {
+	// Read before listing, so evictions during the recount are caught by
+	// the next read
+	evictions := tm.storage.Evictions()
+	tm.countersStale.Store(false)
 
-	return stats
+	tasks, err := tm.List(ctx, Filter{IncludeArchived: true})
+	if err != nil {
+		tm.countersStale.Store(true)
+		return err
+	}
+	tm.stats.reset(tasks)
+	tm.evictions.Store(evictions)
+	return nil
 }
@@ -0,0 +1,254 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/clock"
+	"github.com/bhargavparmar/hive-demo/pkg/database"
+	"github.com/bhargavparmar/hive-demo/pkg/idgen"
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+	"github.com/bhargavparmar/hive-demo/pkg/storage"
+	"github.com/bhargavparmar/hive-demo/pkg/tracing"
+	"github.com/bhargavparmar/hive-demo/pkg/webhooks"
+	"github.com/bhargavparmar/hive-demo/pkg/workers"
+	"github.com/cilium/hive"
+	"github.com/cilium/hive/cell"
+)
+
+// testEnv is a task manager on in-memory storage with a fake clock
+type testEnv struct {
+	tm      *taskManager
+	storage storage.Storage
+	clock   *clock.Fake
+}
+
+// newTestEnv builds the task manager from the same cells as the
+// application. configure adjusts the task configuration. The hive is
+// populated but not started.
+func newTestEnv(tb testing.TB, configure ...func(*Config)) testEnv {
+	tb.Helper()
+	return newTestEnvHive(tb, func(h *hive.Hive) {
+		for _, fn := range configure {
+			hive.AddConfigOverride(h, fn)
+		}
+	})
+}
+
+// newTestEnvHive is newTestEnv for tests that adjust the hive itself, such
+// as the configuration of other cells
+func newTestEnvHive(tb testing.TB, configure func(*hive.Hive)) testEnv {
+	tb.Helper()
+	env, err := buildTestEnv(configure)
+	if err != nil {
+		tb.Fatalf("building task manager: %v", err)
+	}
+	return env
+}
+
+// buildTestEnv is newTestEnvHive returning the error that stopped the task
+// manager from being built
+func buildTestEnv(configure func(*hive.Hive)) (testEnv, error) {
+	env := testEnv{clock: clock.NewFake(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))}
+
+	h := hive.New(
+		tracing.Cell,
+		database.Cell,
+		storage.Cell,
+		metrics.Cell,
+		idgen.Cell,
+		cell.Provide(func() clock.Clock { return env.clock }),
+		workers.Cell,
+		webhooks.Cell,
+		Cell,
+
+		cell.Invoke(func(tm TaskManager, st storage.Storage) {
+			env.tm = tm.(*taskManager)
+			env.storage = st
+		}),
+	)
+	configure(h)
+
+	err := h.Populate(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return env, err
+}
+
+// mustCreate creates a task or fails the test
+func (env testEnv) mustCreate(tb testing.TB, params CreateParams) *Task {
+	tb.Helper()
+	task, err := env.tm.Create(context.Background(), params)
+	if err != nil {
+		tb.Fatalf("creating %q: %v", params.Title, err)
+	}
+	return task
+}
+
+func TestConcurrentCreateStoresEveryTask(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	const goroutines = 500
+	var created atomic.Int64
+	var wg sync.WaitGroup
+	for i := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := env.tm.Create(ctx, CreateParams{Title: fmt.Sprintf("task %d", i)}); err != nil {
+				t.Errorf("creating task %d: %v", i, err)
+				return
+			}
+			created.Add(1)
+		}()
+	}
+	wg.Wait()
+
+	count, err := env.storage.Count(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(count) != created.Load() {
+		t.Fatalf("storage holds %d tasks, want %d", count, created.Load())
+	}
+	if created.Load() != goroutines {
+		t.Fatalf("created %d tasks, want %d", created.Load(), goroutines)
+	}
+}
+
+func TestCreateNeverOverwritesOnIDCollision(t *testing.T) {
+	env := newTestEnv(t)
+	env.tm.ids = fixedIDs("same")
+	ctx := context.Background()
+
+	first := env.mustCreate(t, CreateParams{Title: "first"})
+	if _, err := env.tm.Create(ctx, CreateParams{Title: "second"}); err == nil {
+		t.Fatal("expected an ID collision error")
+	}
+
+	got, err := env.tm.Get(ctx, first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "first" {
+		t.Fatalf("stored task has title %q, want %q", got.Title, "first")
+	}
+}
+
+// fixedIDs is an ID generator that always returns the same ID
+type fixedIDs string
+
+func (id fixedIDs) NewID() string { return string(id) }
+
+func TestInvalidPatchCountsAsValidationError(t *testing.T) {
+	env := newTestEnv(t)
+	task := env.mustCreate(t, CreateParams{Title: "patch me"})
+
+	for _, patch := range []string{`[1, 2]`, `{"title":`} {
+		_, err := env.tm.Patch(context.Background(), task.ID, []byte(patch), false)
+		if !errors.Is(err, ErrInvalidPatch) {
+			t.Fatalf("patch %s: got error %v, want %v", patch, err, ErrInvalidPatch)
+		}
+	}
+
+	byType := env.tm.metrics.GetErrorsByType()
+	if byType[metrics.ErrorValidation] != 2 || byType[metrics.ErrorInternal] != 0 {
+		t.Fatalf("got errors by type %v, want 2 validation errors and no internal ones", byType)
+	}
+}
+
+func TestListOrderIsStable(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	oldest := env.mustCreate(t, CreateParams{Title: "oldest"})
+	env.clock.Advance(time.Second)
+
+	// Tasks created at the same instant are ordered by ID
+	var same []*Task
+	for i := range 20 {
+		same = append(same, env.mustCreate(t, CreateParams{Title: fmt.Sprintf("same %d", i)}))
+	}
+	slices.SortFunc(same, func(a, b *Task) int { return strings.Compare(a.ID, b.ID) })
+	env.clock.Advance(time.Second)
+	newest := env.mustCreate(t, CreateParams{Title: "newest"})
+
+	var want []string
+	for _, task := range append(append([]*Task{oldest}, same...), newest) {
+		want = append(want, task.ID)
+	}
+
+	for range 10 {
+		tasks, err := env.tm.List(ctx, Filter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, task := range tasks {
+			got = append(got, task.ID)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("got tasks %v, want %v", got, want)
+		}
+	}
+}
+
+// gatedInserts is a storage whose SetIfAbsent signals entered and then
+// waits for release
+type gatedInserts struct {
+	storage.Storage
+	entered, release chan struct{}
+}
+
+func (s *gatedInserts) SetIfAbsent(ctx context.Context, key string, value interface{}) (bool, error) {
+	close(s.entered)
+	<-s.release
+	return s.Storage.SetIfAbsent(ctx, key, value)
+}
+
+func TestClearWaitsForCreate(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	gated := &gatedInserts{Storage: env.storage, entered: make(chan struct{}), release: make(chan struct{})}
+	env.tm.storage = gated
+
+	created := make(chan error, 1)
+	go func() {
+		_, err := env.tm.Create(ctx, CreateParams{Title: "in progress"})
+		created <- err
+	}()
+	<-gated.entered
+
+	cleared := make(chan error, 1)
+	go func() {
+		_, err := env.tm.Clear(ctx)
+		cleared <- err
+	}()
+	select {
+	case err := <-cleared:
+		t.Fatalf("Clear returned during a create: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(gated.release)
+	if err := <-created; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-cleared; err != nil {
+		t.Fatal(err)
+	}
+
+	// The create finished first, so the clear removed its task
+	if count, err := env.storage.Count(ctx); err != nil || count != 0 {
+		t.Fatalf("got %d tasks (error %v) after the clear, want none", count, err)
+	}
+	env.expectStats(t, 0, 0, 0, map[string]int{})
+}
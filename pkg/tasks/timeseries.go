@@ -0,0 +1,90 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidTimeSeries is returned when a time series cannot be built from
+// the requested field, interval and range
+var ErrInvalidTimeSeries = errors.New("invalid time series")
+
+// Timestamps a time series can count tasks by
+const (
+	TimeSeriesCreated = "created"
+	TimeSeriesUpdated = "updated"
+)
+
+// MaxTimeSeriesBuckets is the largest number of buckets a time series may
+// have
+const MaxTimeSeriesBuckets = 1000
+
+// Bucket counts the tasks whose timestamp falls in [Start, Start+interval)
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// TimeSeries counts tasks, archived ones included, by the given timestamp
+// in buckets of interval covering from to to. Times are compared in UTC and
+// buckets start at multiples of interval since the zero time, so daily
+// buckets start at midnight UTC; from is rounded down and to up to bucket
+// boundaries. Buckets without tasks are included with a count of 0.
+func (tm *taskManager) TimeSeries(ctx context.Context, field string, interval time.Duration, from, to time.Time) ([]Bucket, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.TimeSeries")
+	defer span.End()
+
+	start, buckets, err := timeSeriesRange(field, interval, from, to)
+	if err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return nil, err
+	}
+
+	list, err := tm.List(ctx, Filter{IncludeArchived: true})
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]Bucket, buckets)
+	for i := range series {
+		series[i].Start = start.Add(time.Duration(i) * interval)
+	}
+	for _, task := range list {
+		ts := task.CreatedAt
+		if field == TimeSeriesUpdated {
+			ts = task.UpdatedAt
+		}
+		if offset := ts.UTC().Sub(start); offset >= 0 {
+			if i := int(offset / interval); i < buckets {
+				series[i].Count++
+			}
+		}
+	}
+	return series, nil
+}
+
+// timeSeriesRange checks the parameters of a time series and returns the
+// start of its first bucket and the number of buckets
+func timeSeriesRange(field string, interval time.Duration, from, to time.Time) (time.Time, int, error) {
+	switch {
+	case field != TimeSeriesCreated && field != TimeSeriesUpdated:
+		return time.Time{}, 0, fmt.Errorf("%w: field must be %s or %s, got %q", ErrInvalidTimeSeries, TimeSeriesCreated, TimeSeriesUpdated, field)
+	case interval < time.Minute:
+		return time.Time{}, 0, fmt.Errorf("%w: interval must be at least a minute, got %s", ErrInvalidTimeSeries, interval)
+	case from.IsZero() || to.IsZero() || !from.Before(to):
+		return time.Time{}, 0, fmt.Errorf("%w: from must be before to", ErrInvalidTimeSeries)
+	}
+
+	start := from.UTC().Truncate(interval)
+	end := to.UTC().Truncate(interval)
+	if end.Before(to.UTC()) {
+		end = end.Add(interval)
+	}
+	buckets := end.Sub(start) / interval
+	if buckets > MaxTimeSeriesBuckets {
+		return time.Time{}, 0, fmt.Errorf("%w: at most %d buckets allowed, got %d", ErrInvalidTimeSeries, MaxTimeSeriesBuckets, buckets)
+	}
+	return start, int(buckets), nil
+}
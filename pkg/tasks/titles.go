@@ -0,0 +1,40 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrDuplicateTitle is returned when titles must be unique and another task
+// already has the title
+var ErrDuplicateTitle = errors.New("duplicate task title")
+
+// checkUniqueTitle rejects a write giving task the title of another task,
+// archived or not, when UniqueTitles is configured. old is the stored task
+// being replaced, nil for new tasks. Titles are looked up in the task
+// counters, which are recounted first if they are out of date.
+func (tm *taskManager) checkUniqueTitle(ctx context.Context, old, task *Task) error {
+	if tm.titleMu == nil || (old != nil && old.Title == task.Title) {
+		return nil
+	}
+
+	if _, err := tm.taskStats(ctx); err != nil {
+		return err
+	}
+	if tm.stats.titleCount(task.Title) > 0 {
+		return fmt.Errorf("%w: %q is already in use", ErrDuplicateTitle, task.Title)
+	}
+	return nil
+}
+
+// lockUniqueTitles serializes the writes that check for duplicate titles.
+// It returns the function that releases the lock, and does nothing when
+// titles need not be unique.
+func (tm *taskManager) lockUniqueTitles() func() {
+	if tm.titleMu == nil {
+		return func() {}
+	}
+	tm.titleMu.Lock()
+	return tm.titleMu.Unlock
+}
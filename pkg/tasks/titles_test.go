@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func uniqueTitles(cfg *Config) { cfg.UniqueTitles = true }
+
+func TestUniqueTitles(t *testing.T) {
+	env := newTestEnv(t, uniqueTitles)
+	ctx := context.Background()
+	deploy := env.mustCreate(t, CreateParams{Title: "Deploy"})
+	other := env.mustCreate(t, CreateParams{Title: "Other"})
+
+	expectDuplicate := func(t *testing.T, err error) {
+		t.Helper()
+		if !errors.Is(err, ErrDuplicateTitle) {
+			t.Fatalf("got error %v, want %v", err, ErrDuplicateTitle)
+		}
+	}
+
+	t.Run("create", func(t *testing.T) {
+		_, err := env.tm.Create(ctx, CreateParams{Title: "Deploy"})
+		expectDuplicate(t, err)
+
+		// Titles are compared exactly
+		env.mustCreate(t, CreateParams{Title: "deploy"})
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		_, err := env.tm.Update(ctx, other.ID, "Deploy", "", "", nil, nil, nil, false)
+		expectDuplicate(t, err)
+
+		_, err = env.tm.Patch(ctx, other.ID, []byte(`{"title":"Deploy"}`), false)
+		expectDuplicate(t, err)
+
+		results, err := env.tm.Upsert(ctx, []*Task{{ID: other.ID, Title: "Deploy"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectDuplicate(t, results[0].Err)
+	})
+
+	t.Run("keep own title", func(t *testing.T) {
+		if _, err := env.tm.Update(ctx, deploy.ID, "Deploy", "changed", "", nil, nil, nil, false); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("archived", func(t *testing.T) {
+		archived := env.mustCreate(t, CreateParams{Title: "Archived"})
+		if _, err := env.tm.Archive(ctx, archived.ID); err != nil {
+			t.Fatal(err)
+		}
+		_, err := env.tm.Create(ctx, CreateParams{Title: "Archived"})
+		expectDuplicate(t, err)
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		deleted := env.mustCreate(t, CreateParams{Title: "Deleted"})
+		if err := env.tm.Delete(ctx, deleted.ID, nil, false); err != nil {
+			t.Fatal(err)
+		}
+		env.mustCreate(t, CreateParams{Title: "Deleted"})
+	})
+}
+
+func TestUniqueTitlesConcurrentCreate(t *testing.T) {
+	env := newTestEnv(t, uniqueTitles)
+	ctx := context.Background()
+
+	const goroutines = 50
+	var created atomic.Int64
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := env.tm.Create(ctx, CreateParams{Title: "same"})
+			switch {
+			case err == nil:
+				created.Add(1)
+			case !errors.Is(err, ErrDuplicateTitle):
+				t.Errorf("got error %v, want %v", err, ErrDuplicateTitle)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created.Load() != 1 {
+		t.Fatalf("created %d tasks with the same title, want 1", created.Load())
+	}
+}
+
+func TestDuplicateTitlesAllowedByDefault(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustCreate(t, CreateParams{Title: "same"})
+	env.mustCreate(t, CreateParams{Title: "same"})
+}
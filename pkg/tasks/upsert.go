@@ -0,0 +1,141 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+)
+
+// Upsert writes a batch of tasks for clients that sync their own copy.
+// Items without an ID are created. Items with an ID replace the title,
+// description, status, assignee, labels, effort and due date of that task,
+// keeping its status if they have none; its other fields cannot be changed
+// this way. An ID that does not exist fails with ErrTaskNotFound, or is
+// created with that ID if UpsertCreateMissing is configured, unless the ID
+// is the name of one of the API's fixed /tasks/ paths. Every item is
+// validated and written on its own, so some may fail while others succeed.
+func (tm *taskManager) Upsert(ctx context.Context, items []*Task) ([]BatchResult, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Upsert")
+	defer span.End()
+
+	switch {
+	case len(items) == 0:
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, fmt.Errorf("%w: no tasks given", ErrInvalidBatch)
+	case len(items) > MaxBatchSize:
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, fmt.Errorf("%w: at most %d tasks allowed, got %d", ErrInvalidBatch, MaxBatchSize, len(items))
+	}
+
+	results := make([]BatchResult, len(items))
+	created, updated := 0, 0
+	for i, item := range items {
+		var res BatchResult
+		if item.ID == "" {
+			res.Task, res.Err = tm.Create(ctx, item.createParams())
+			res.Created = res.Err == nil
+		} else {
+			res.Task, res.Created, res.Err = tm.upsertOne(ctx, item)
+		}
+		if res.Task != nil {
+			res.ID = res.Task.ID
+		} else {
+			res.ID = item.ID
+		}
+		results[i] = res
+
+		switch {
+		case res.Err != nil:
+		case res.Created:
+			created++
+		default:
+			updated++
+		}
+	}
+	tm.logger.Info("Tasks upserted", "created", created, "updated", updated, "failed", len(items)-created-updated)
+
+	return results, nil
+}
+
+// upsertOne replaces the fields of the task with the item's ID, or creates
+// it if it does not exist and that is allowed. It reports whether the task
+// was created.
+func (tm *taskManager) upsertOne(ctx context.Context, item *Task) (*Task, bool, error) {
+	defer tm.locks.lock(item.ID)()
+
+	current, err := tm.load(ctx, item.ID)
+	switch {
+	case errors.Is(err, ErrTaskNotFound) && tm.cfg.UpsertCreateMissing:
+		if tm.isReserved(item.ID) {
+			err := fmt.Errorf("%w: %q is reserved by the API", ErrInvalidID, item.ID)
+			tm.metrics.IncrementErrorsByType(ErrorType(err))
+			return nil, false, err
+		}
+		now := tm.clock.Now()
+		task := tm.newTask(item.createParams(), now)
+		task.ID = item.ID
+		task, err := tm.insert(ctx, task, now)
+		return task, err == nil, err
+	case err != nil:
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return nil, false, err
+	}
+
+	task := *current
+	task.Title = item.Title
+	task.Description = item.Description
+	if item.Status != "" {
+		task.Status = item.Status
+	}
+	task.Assignee = item.Assignee
+	task.Labels = maps.Clone(item.Labels)
+	task.EstimateMinutes = item.EstimateMinutes
+	task.SpentMinutes = item.SpentMinutes
+	task.DueAt = item.DueAt
+	task.UpdatedAt = tm.clock.Now()
+
+	if err := tm.validate(ctx, &task); err != nil {
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, false, err
+	}
+
+	defer tm.lockUniqueTitles()()
+	if err := tm.checkUniqueTitle(ctx, current, &task); err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return nil, false, err
+	}
+
+	defer tm.lockOpenLimit()()
+	if err := tm.checkOpenLimit(ctx, current, &task); err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return nil, false, err
+	}
+
+	if err := tm.storage.Set(ctx, task.ID, &task); err != nil {
+		return nil, false, err
+	}
+	tm.stats.replace(current, &task)
+	tm.version.Add(1)
+	tm.logger.Info("Task updated", "id", task.ID)
+	tm.hooks.Publish(EventUpdated, &task)
+
+	return &task, false, nil
+}
+
+// createParams returns the fields of an upserted task that a new task takes
+func (t *Task) createParams() CreateParams {
+	return CreateParams{
+		Title:       t.Title,
+		Description: t.Description,
+		Assignee:    t.Assignee,
+		Labels:      t.Labels,
+		Status:      t.Status,
+
+		EstimateMinutes: t.EstimateMinutes,
+		SpentMinutes:    t.SpentMinutes,
+		DueAt:           t.DueAt,
+	}
+}
@@ -0,0 +1,271 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bhargavparmar/hive-demo/pkg/features"
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+)
+
+// ErrValidation is matched by every *ValidationError
+var ErrValidation = errors.New("validation failed")
+
+// FieldError describes why a single field of a task is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+
+	// err is the sentinel error for the failure, if there is one
+	err error
+}
+
+// ValidationError lists every invalid field of a task
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap exposes ErrValidation and the sentinel errors of the individual
+// fields so callers can match them with errors.Is
+func (e *ValidationError) Unwrap() []error {
+	errs := []error{ErrValidation}
+	for _, f := range e.Fields {
+		if f.err != nil {
+			errs = append(errs, f.err)
+		}
+	}
+	return errs
+}
+
+// Warning describes a field that is valid but probably not what the caller
+// intended. Unlike a FieldError it never causes a write to be rejected.
+type Warning struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// descriptionWarnLength is the description length in characters above which
+// Validate warns
+const descriptionWarnLength = 2000
+
+// Validate checks a task against all validation rules and reports every
+// failing field at once. The error is nil or a *ValidationError. Warnings
+// are returned for valid tasks too and do not make the task invalid.
+func (tm *taskManager) Validate(task *Task) ([]Warning, error) {
+	var fields []FieldError
+
+	switch {
+	case task.Title == "":
+		fields = append(fields, FieldError{Field: "title", Message: "is required", err: ErrTitleRequired})
+	case utf8.RuneCountInString(task.Title) > tm.cfg.MaxTitleLength:
+		fields = append(fields, FieldError{
+			Field:   "title",
+			Message: fmt.Sprintf("must be at most %d characters", tm.cfg.MaxTitleLength),
+		})
+	}
+
+	if utf8.RuneCountInString(task.Description) > tm.cfg.MaxDescriptionLength {
+		fields = append(fields, FieldError{
+			Field:   "description",
+			Message: fmt.Sprintf("must be at most %d characters", tm.cfg.MaxDescriptionLength),
+		})
+	}
+
+	if !tm.statuses[task.Status] {
+		fields = append(fields, FieldError{
+			Field:   "status",
+			Message: fmt.Sprintf("must be one of %s", strings.Join(tm.cfg.Statuses, ", ")),
+			err:     ErrInvalidStatus,
+		})
+	}
+
+	fields = append(fields, validateLabels(task.Labels)...)
+	fields = append(fields, validateEffort(task)...)
+	fields = append(fields, validateWatchers(task.Watchers)...)
+
+	warnings := tm.warnings(task)
+	if len(fields) > 0 {
+		return warnings, &ValidationError{Fields: fields}
+	}
+	return warnings, nil
+}
+
+// validateWrite validates a task about to be written. With the
+// strict-validation feature flag on for the request, warnings make the task
+// invalid as well and no warnings are returned.
+func (tm *taskManager) validateWrite(ctx context.Context, task *Task) ([]Warning, error) {
+	warnings, err := tm.Validate(task)
+	if len(warnings) == 0 || !features.Enabled(ctx, features.StrictValidation) {
+		return warnings, err
+	}
+
+	var fields []FieldError
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		fields = validationErr.Fields
+	}
+	for _, w := range warnings {
+		fields = append(fields, FieldError{Field: w.Field, Message: w.Message})
+	}
+	return nil, &ValidationError{Fields: fields}
+}
+
+// validate is validateWrite for callers that do not report warnings
+func (tm *taskManager) validate(ctx context.Context, task *Task) error {
+	_, err := tm.validateWrite(ctx, task)
+	return err
+}
+
+// ValidationResult is the outcome of validating one task of a batch. Err is
+// nil or a *ValidationError.
+type ValidationResult struct {
+	Warnings []Warning
+	Err      error
+}
+
+// ValidateBatch checks the tasks that Create would build from params with
+// the same rules, including strict validation when the request asks for it,
+// without generating IDs or touching storage. Invalid tasks
+// are reported in their result and, as nothing failed, not counted as
+// errors. Limits that depend on the stored tasks, such as the open task
+// limit, are not checked.
+func (tm *taskManager) ValidateBatch(ctx context.Context, params []CreateParams) ([]ValidationResult, error) {
+	switch {
+	case len(params) == 0:
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, fmt.Errorf("%w: no tasks given", ErrInvalidBatch)
+	case len(params) > MaxBatchSize:
+		tm.metrics.IncrementErrorsByType(metrics.ErrorValidation)
+		return nil, fmt.Errorf("%w: at most %d tasks allowed, got %d", ErrInvalidBatch, MaxBatchSize, len(params))
+	}
+
+	now := tm.clock.Now()
+	results := make([]ValidationResult, len(params))
+	for i, p := range params {
+		results[i].Warnings, results[i].Err = tm.validateWrite(ctx, tm.newTask(p, now))
+	}
+	return results, nil
+}
+
+// warnings returns the non-fatal issues with a task
+func (tm *taskManager) warnings(task *Task) []Warning {
+	var warnings []Warning
+
+	if task.Title != strings.TrimSpace(task.Title) {
+		warnings = append(warnings, Warning{Field: "title", Message: "has leading or trailing whitespace"})
+	}
+	// Descriptions over the limit are rejected instead
+	if n := utf8.RuneCountInString(task.Description); n > descriptionWarnLength && n <= tm.cfg.MaxDescriptionLength {
+		warnings = append(warnings, Warning{
+			Field:   "description",
+			Message: fmt.Sprintf("is very long (%d characters); consider linking to a document instead", n),
+		})
+	}
+
+	return warnings
+}
+
+// Limits on task labels
+const (
+	MaxLabels           = 32
+	MaxLabelKeyLength   = 63
+	MaxLabelValueLength = 255
+)
+
+// validateLabels checks the number of labels and the format of each
+func validateLabels(labels map[string]string) []FieldError {
+	if len(labels) > MaxLabels {
+		return []FieldError{{Field: "labels", Message: fmt.Sprintf("must have at most %d labels", MaxLabels)}}
+	}
+
+	var fields []FieldError
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		var msg string
+		switch value := labels[key]; {
+		case key == "":
+			msg = "keys must not be empty"
+		case len(key) > MaxLabelKeyLength:
+			msg = fmt.Sprintf("key %q must be at most %d characters", key, MaxLabelKeyLength)
+		case !validLabelKey(key):
+			msg = fmt.Sprintf("key %q must contain only letters, digits, '-', '_', '.' and '/'", key)
+		case value == "":
+			msg = fmt.Sprintf("value of %q must not be empty", key)
+		case utf8.RuneCountInString(value) > MaxLabelValueLength:
+			msg = fmt.Sprintf("value of %q must be at most %d characters", key, MaxLabelValueLength)
+		default:
+			continue
+		}
+		fields = append(fields, FieldError{Field: "labels", Message: msg})
+	}
+	return fields
+}
+
+// validLabelKey reports whether a label key contains only the allowed
+// characters
+func validLabelKey(key string) bool {
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validateFilter checks that the filter values are valid
+func (tm *taskManager) validateFilter(f Filter) error {
+	if f.Status != "" && !tm.statuses[f.Status] {
+		return fmt.Errorf("%w: %s", ErrInvalidStatus, f.Status)
+	}
+	return nil
+}
+
+// statusSet checks the configured statuses and returns them as a set
+func statusSet(statuses []string) (map[string]bool, error) {
+	if len(statuses) == 0 {
+		return nil, errors.New("task-statuses must not be empty")
+	}
+
+	set := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		switch {
+		case strings.TrimSpace(status) == "":
+			return nil, errors.New("task-statuses must not contain empty statuses")
+		case set[status]:
+			return nil, fmt.Errorf("task-statuses contains %s more than once", status)
+		}
+		set[status] = true
+	}
+	return set, nil
+}
+
+// terminalSet turns the configured terminal statuses into a set, checking
+// that each is one of the allowed statuses
+func terminalSet(terminal []string, statuses map[string]bool) (map[string]bool, error) {
+	set := make(map[string]bool, len(terminal))
+	for _, status := range terminal {
+		switch {
+		case !statuses[status]:
+			return nil, fmt.Errorf("task-terminal-statuses: %s is not one of task-statuses", status)
+		case set[status]:
+			return nil, fmt.Errorf("task-terminal-statuses contains %s more than once", status)
+		}
+		set[status] = true
+	}
+	return set, nil
+}
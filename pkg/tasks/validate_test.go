@@ -0,0 +1,72 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLengthLimits(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	titleLimit, descLimit := env.tm.cfg.MaxTitleLength, env.tm.cfg.MaxDescriptionLength
+	if titleLimit != 200 || descLimit != 5000 {
+		t.Fatalf("got default limits %d and %d, want 200 and 5000", titleLimit, descLimit)
+	}
+
+	// Limits count characters, not bytes
+	text := func(n int) string { return strings.Repeat("é", n) }
+
+	writes := map[string]func(title, description string) error{
+		"create": func(title, description string) error {
+			_, err := env.tm.Create(ctx, CreateParams{Title: title, Description: description})
+			return err
+		},
+		"update": func(title, description string) error {
+			task := env.mustCreate(t, CreateParams{Title: "update me"})
+			_, err := env.tm.Update(ctx, task.ID, title, description, "", nil, nil, nil, false)
+			return err
+		},
+		"patch": func(title, description string) error {
+			task := env.mustCreate(t, CreateParams{Title: "patch me"})
+			patch, err := json.Marshal(map[string]string{"title": title, "description": description})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = env.tm.Patch(ctx, task.ID, patch, false)
+			return err
+		},
+	}
+
+	for name, write := range writes {
+		t.Run(name, func(t *testing.T) {
+			if err := write(text(titleLimit), text(descLimit)); err != nil {
+				t.Fatalf("at the limits: %v", err)
+			}
+
+			for _, tc := range []struct {
+				field              string
+				limit              int
+				title, description string
+			}{
+				{field: "title", limit: titleLimit, title: text(titleLimit + 1), description: "fits"},
+				{field: "description", limit: descLimit, title: "fits", description: text(descLimit + 1)},
+			} {
+				err := write(tc.title, tc.description)
+				var verr *ValidationError
+				if !errors.As(err, &verr) {
+					t.Fatalf("%s one over the limit: got error %v, want a validation error", tc.field, err)
+				}
+				if len(verr.Fields) != 1 || verr.Fields[0].Field != tc.field {
+					t.Fatalf("%s one over the limit: got fields %v", tc.field, verr.Fields)
+				}
+				if msg := verr.Fields[0].Message; !strings.Contains(msg, strconv.Itoa(tc.limit)) {
+					t.Fatalf("%s one over the limit: got message %q, want the limit %d", tc.field, msg, tc.limit)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Limits on task watchers
+const (
+	MaxWatchers      = 100
+	MaxWatcherLength = 64
+)
+
+// ErrInvalidWatcher is returned for a malformed watcher or when a task
+// already has MaxWatchers watchers
+var ErrInvalidWatcher = errors.New("invalid watcher")
+
+// ValidateWatcher checks that a watcher is 1 to MaxWatcherLength ASCII
+// letters, digits, '-', '_', '.' and '@', enough for user names and email
+// addresses
+func ValidateWatcher(watcher string) error {
+	switch {
+	case watcher == "":
+		return fmt.Errorf("%w: must not be empty", ErrInvalidWatcher)
+	case len(watcher) > MaxWatcherLength:
+		return fmt.Errorf("%w: must be at most %d characters", ErrInvalidWatcher, MaxWatcherLength)
+	}
+
+	for _, r := range watcher {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == '@':
+		default:
+			return fmt.Errorf("%w: %q may only contain letters, digits, '-', '_', '.' and '@'", ErrInvalidWatcher, watcher)
+		}
+	}
+	return nil
+}
+
+// validateWatchers checks the number of watchers, the format of each and
+// that none is listed twice
+func validateWatchers(watchers []string) []FieldError {
+	if len(watchers) > MaxWatchers {
+		return []FieldError{{Field: "watchers", Message: fmt.Sprintf("must have at most %d watchers", MaxWatchers)}}
+	}
+
+	var fields []FieldError
+	seen := make(map[string]bool, len(watchers))
+	for _, watcher := range watchers {
+		if err := ValidateWatcher(watcher); err != nil {
+			fields = append(fields, FieldError{Field: "watchers", Message: err.Error(), err: ErrInvalidWatcher})
+		} else if seen[watcher] {
+			fields = append(fields, FieldError{Field: "watchers", Message: fmt.Sprintf("%q is listed twice", watcher), err: ErrInvalidWatcher})
+		}
+		seen[watcher] = true
+	}
+	return fields
+}
+
+// Watch adds a watcher to a task. Adding a watcher twice has no effect.
+func (tm *taskManager) Watch(ctx context.Context, id, watcher string) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Watch")
+	defer span.End()
+
+	return tm.setWatching(ctx, id, watcher, true)
+}
+
+// Unwatch removes a watcher from a task. Removing a watcher the task does
+// not have has no effect.
+func (tm *taskManager) Unwatch(ctx context.Context, id, watcher string) (*Task, error) {
+	ctx, span := tm.tracer.Start(ctx, "tasks.Unwatch")
+	defer span.End()
+
+	return tm.setWatching(ctx, id, watcher, false)
+}
+
+func (tm *taskManager) setWatching(ctx context.Context, id, watcher string, watching bool) (*Task, error) {
+	if err := ValidateWatcher(watcher); err != nil {
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return nil, err
+	}
+
+	defer tm.locks.lock(id)()
+
+	current, err := tm.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(current.Watchers, watcher) == watching {
+		return current, nil
+	}
+	if watching && len(current.Watchers) >= MaxWatchers {
+		err := fmt.Errorf("%w: task %s already has %d watchers", ErrInvalidWatcher, id, MaxWatchers)
+		tm.metrics.IncrementErrorsByType(ErrorType(err))
+		return nil, err
+	}
+
+	task := *current
+	if watching {
+		task.setWatchers(append(slices.Clone(current.Watchers), watcher))
+	} else {
+		task.setWatchers(slices.DeleteFunc(slices.Clone(current.Watchers), func(w string) bool { return w == watcher }))
+	}
+	task.UpdatedAt = tm.clock.Now()
+
+	if err := tm.storage.Set(ctx, id, &task); err != nil {
+		return nil, err
+	}
+	tm.stats.replace(current, &task)
+	tm.version.Add(1)
+	tm.logger.Info("Task watchers changed", "id", id, "watcher", watcher, "watching", watching)
+	tm.hooks.Publish(EventUpdated, &task)
+
+	return &task, nil
+}
+
+// setWatchers replaces the watchers of the task, keeping WatcherCount in
+// step
+func (t *Task) setWatchers(watchers []string) {
+	if len(watchers) == 0 {
+		watchers = nil
+	}
+	t.Watchers = watchers
+	t.WatcherCount = len(watchers)
+}
@@ -0,0 +1,64 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+)
+
+// isOpen reports whether a task counts towards its assignee's limit on open
+// tasks
+func (tm *taskManager) isOpen(task *Task) bool {
+	return task.Assignee != "" && !tm.terminal[task.Status]
+}
+
+// openLimit returns the maximum number of open tasks for an assignee, 0 for
+// no limit
+func (tm *taskManager) openLimit(assignee string) int {
+	if limit, ok := tm.cfg.MaxOpenPerAssigneeOverrides[assignee]; ok {
+		return limit
+	}
+	return tm.cfg.MaxOpenPerAssignee
+}
+
+// checkOpenLimit returns ErrOpenLimit if storing task in place of old, which
+// is nil for a new task, would take its assignee over their open task limit.
+// The caller must hold tm.openMu until the task is stored, so concurrent
+// writes cannot both take the last slot.
+func (tm *taskManager) checkOpenLimit(ctx context.Context, old, task *Task) error {
+	if !tm.isOpen(task) || (old != nil && tm.isOpen(old) && old.Assignee == task.Assignee) {
+		return nil
+	}
+
+	limit := tm.openLimit(task.Assignee)
+	if limit <= 0 {
+		return nil
+	}
+
+	all, err := tm.storage.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	open := 0
+	for id, val := range all {
+		if t, ok := tm.listed(id, val); ok && t.ID != task.ID && t.Assignee == task.Assignee && tm.isOpen(t) {
+			open++
+		}
+	}
+
+	if open >= limit {
+		return fmt.Errorf("%w: %s already has %d open tasks", ErrOpenLimit, task.Assignee, open)
+	}
+	return nil
+}
+
+// lockOpenLimit serializes the writes that check the open task limit. It
+// returns the function that releases the lock, and does nothing when no
+// limit is configured.
+func (tm *taskManager) lockOpenLimit() func() {
+	if tm.openMu == nil {
+		return func() {}
+	}
+	tm.openMu.Lock()
+	return tm.openMu.Unlock
+}
@@ -0,0 +1,151 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cilium/hive"
+)
+
+// customStatuses replaces the statuses with a workflow finishing in done or
+// wontfix
+func customStatuses(cfg *Config) {
+	cfg.Statuses = []string{"todo", "doing", "done", "wontfix"}
+	cfg.TerminalStatuses = []string{"done", "wontfix"}
+	cfg.MaxOpenPerAssignee = 1
+}
+
+func TestTerminalStatuses(t *testing.T) {
+	env := newTestEnv(t, customStatuses)
+	ctx := context.Background()
+	due := env.clock.Now().Add(time.Hour)
+
+	finished := env.mustCreate(t, CreateParams{Title: "finished", Assignee: "alice", Status: "done", DueAt: &due})
+	if env.tm.isOpen(finished) {
+		t.Fatal("a task in a terminal status counts as open")
+	}
+	if !env.tm.dueDate(finished).IsZero() {
+		t.Fatal("a task in a terminal status gets a reminder")
+	}
+
+	// Completed is not terminal here, nor even allowed
+	open := env.mustCreate(t, CreateParams{Title: "open", Assignee: "alice", DueAt: &due})
+	if !env.tm.isOpen(open) {
+		t.Fatal("a task in the default status does not count as open")
+	}
+	if !env.tm.dueDate(open).Equal(due) {
+		t.Fatal("an open task gets no reminder")
+	}
+	if _, err := env.tm.Create(ctx, CreateParams{Title: "over", Assignee: "alice", Status: "doing"}); !errors.Is(err, ErrOpenLimit) {
+		t.Fatalf("got error %v, want %v", err, ErrOpenLimit)
+	}
+}
+
+func TestTerminalStatusesMustBeAllowed(t *testing.T) {
+	for name, tc := range map[string]struct {
+		terminal []string
+		want     string
+	}{
+		"unknown":   {terminal: []string{"done", "completed"}, want: "completed is not one of task-statuses"},
+		"duplicate": {terminal: []string{"done", "done"}, want: "done more than once"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := buildTestEnv(func(h *hive.Hive) {
+				hive.AddConfigOverride(h, func(cfg *Config) {
+					customStatuses(cfg)
+					cfg.TerminalStatuses = tc.terminal
+				})
+			})
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("got error %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// expectOpenLimit fails the test unless err is ErrOpenLimit
+func expectOpenLimit(tb testing.TB, err error) {
+	tb.Helper()
+	if !errors.Is(err, ErrOpenLimit) {
+		tb.Fatalf("got error %v, want %v", err, ErrOpenLimit)
+	}
+}
+
+func TestOpenLimitBoundary(t *testing.T) {
+	const limit = 3
+	env := newTestEnv(t, func(cfg *Config) {
+		cfg.MaxOpenPerAssignee = limit
+		cfg.MaxOpenPerAssigneeOverrides = map[string]int{"bob": 1, "carol": 0}
+	})
+	ctx := context.Background()
+
+	t.Run("create", func(t *testing.T) {
+		var tasks []*Task
+		for i := range limit {
+			tasks = append(tasks, env.mustCreate(t, CreateParams{Title: fmt.Sprintf("alice %d", i), Assignee: "alice"}))
+		}
+		_, err := env.tm.Create(ctx, CreateParams{Title: "one over", Assignee: "alice"})
+		expectOpenLimit(t, err)
+
+		// Finished and unassigned tasks do not count
+		env.mustCreate(t, CreateParams{Title: "finished", Assignee: "alice", Status: StatusCompleted})
+		env.mustCreate(t, CreateParams{Title: "unassigned"})
+
+		// Finishing a task frees its slot
+		if _, err := env.tm.Update(ctx, tasks[0].ID, "", "", StatusCancelled, nil, nil, nil, false); err != nil {
+			t.Fatal(err)
+		}
+		env.mustCreate(t, CreateParams{Title: "back at the limit", Assignee: "alice"})
+	})
+
+	t.Run("override", func(t *testing.T) {
+		env.mustCreate(t, CreateParams{Title: "bob 0", Assignee: "bob"})
+		_, err := env.tm.Create(ctx, CreateParams{Title: "bob 1", Assignee: "bob"})
+		expectOpenLimit(t, err)
+
+		// A limit of 0 removes the global one
+		for i := range limit + 1 {
+			env.mustCreate(t, CreateParams{Title: fmt.Sprintf("carol %d", i), Assignee: "carol"})
+		}
+	})
+
+	t.Run("reassign", func(t *testing.T) {
+		task := env.mustCreate(t, CreateParams{Title: "dave 0", Assignee: "dave"})
+		_, err := env.tm.Patch(ctx, task.ID, []byte(`{"assignee":"bob"}`), false)
+		expectOpenLimit(t, err)
+
+		for i := range limit - 1 {
+			env.mustCreate(t, CreateParams{Title: fmt.Sprintf("erin %d", i), Assignee: "erin"})
+		}
+		if _, err := env.tm.Patch(ctx, task.ID, []byte(`{"assignee":"erin"}`), false); err != nil {
+			t.Fatalf("reassigning up to the limit: %v", err)
+		}
+	})
+
+	t.Run("reopen", func(t *testing.T) {
+		finished := env.mustCreate(t, CreateParams{Title: "bob finished", Assignee: "bob", Status: StatusCompleted})
+		_, err := env.tm.Update(ctx, finished.ID, "", "", StatusInProgress, nil, nil, nil, false)
+		expectOpenLimit(t, err)
+
+		got, err := env.tm.Get(ctx, finished.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != StatusCompleted {
+			t.Fatalf("a rejected reopen left status %s", got.Status)
+		}
+
+		// An open task at the limit can still change
+		open := env.mustCreate(t, CreateParams{Title: "frank 0", Assignee: "frank"})
+		for i := 1; i < limit; i++ {
+			env.mustCreate(t, CreateParams{Title: fmt.Sprintf("frank %d", i), Assignee: "frank"})
+		}
+		if _, err := env.tm.Update(ctx, open.ID, "", "changed", StatusInProgress, nil, nil, nil, false); err != nil {
+			t.Fatalf("changing an open task at the limit: %v", err)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+	"github.com/cilium/hive/cell"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Cell provides an OpenTelemetry tracer provider
+var Cell = cell.Module(
+	"tracing",
+	"Distributed Tracing",
+
+	cell.Config(defaultConfig),
+	metrics.TimeHooks(
+		cell.Provide(newTracerProvider),
+	),
+)
+
+// Propagator reads and writes W3C trace context (traceparent) headers
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// Config holds tracing configuration
+type Config struct {
+	OTLPEndpoint string `mapstructure:"tracing-otlp-endpoint"`
+	ServiceName  string `mapstructure:"tracing-service-name"`
+}
+
+var defaultConfig = Config{
+	OTLPEndpoint: "",
+	ServiceName:  "task-manager",
+}
+
+// Flags implements cell.Flagger
+func (c Config) Flags(flags *pflag.FlagSet) {
+	flags.String("tracing-otlp-endpoint", c.OTLPEndpoint, "OTLP/HTTP endpoint URL to export traces to, e.g. http://localhost:4318 (empty disables tracing)")
+	flags.String("tracing-service-name", c.ServiceName, "Service name reported in exported traces")
+}
+
+// newTracerProvider creates a tracer provider exporting to the configured
+// OTLP endpoint, or a no-op provider when no endpoint is configured
+func newTracerProvider(lc cell.Lifecycle, cfg Config, logger *slog.Logger) (trace.TracerProvider, error) {
+	logger = logger.With("component", "tracing")
+
+	if cfg.OTLPEndpoint == "" {
+		logger.Debug("Tracing disabled")
+		return noop.NewTracerProvider(), nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP trace exporter: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", cfg.ServiceName),
+		)),
+	)
+
+	lc.Append(cell.Hook{
+		OnStart: func(ctx cell.HookContext) error {
+			logger.Info("Tracing enabled", "endpoint", cfg.OTLPEndpoint)
+			return nil
+		},
+		OnStop: func(ctx cell.HookContext) error {
+			logger.Info("Flushing traces...")
+			return tp.Shutdown(ctx)
+		},
+	})
+
+	return tp, nil
+}
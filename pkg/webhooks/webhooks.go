@@ -0,0 +1,358 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/clock"
+	"github.com/bhargavparmar/hive-demo/pkg/idgen"
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+	"github.com/bhargavparmar/hive-demo/pkg/workers"
+	"github.com/cilium/hive/cell"
+	"github.com/spf13/pflag"
+)
+
+// Cell delivers events to the configured webhook URLs
+var Cell = cell.Module(
+	"webhooks",
+	"Webhook Delivery",
+
+	cell.Config(defaultConfig),
+	metrics.TimeHooks(
+		cell.Provide(newDispatcher),
+	),
+)
+
+const (
+	// maxInFlight bounds the deliveries being attempted or waiting to be
+	// retried. Events published beyond it go straight to the dead-letter
+	// list.
+	maxInFlight = 1000
+	// maxDeadLetters bounds the dead-letter list; the oldest entries are
+	// dropped first
+	maxDeadLetters = 1000
+)
+
+// Config holds webhook configuration
+type Config struct {
+	URLs        []string      `mapstructure:"webhook-urls"`
+	MaxAttempts int           `mapstructure:"webhook-max-attempts"`
+	Backoff     time.Duration `mapstructure:"webhook-backoff"`
+	MaxBackoff  time.Duration `mapstructure:"webhook-max-backoff"`
+	Timeout     time.Duration `mapstructure:"webhook-timeout"`
+}
+
+var defaultConfig = Config{
+	URLs:        nil,
+	MaxAttempts: 5,
+	Backoff:     time.Second,
+	MaxBackoff:  time.Minute,
+	Timeout:     5 * time.Second,
+}
+
+// Flags implements cell.Flagger
+func (c Config) Flags(flags *pflag.FlagSet) {
+	flags.StringSlice("webhook-urls", c.URLs, "URLs that task events are POSTed to (none to disable webhooks)")
+	flags.Int("webhook-max-attempts", c.MaxAttempts, "Delivery attempts per webhook before the event is dead-lettered")
+	flags.Duration("webhook-backoff", c.Backoff, "Delay before the first webhook retry, doubled after each further failure")
+	flags.Duration("webhook-max-backoff", c.MaxBackoff, "Maximum delay between webhook retries")
+	flags.Duration("webhook-timeout", c.Timeout, "Timeout of a single webhook delivery attempt")
+}
+
+// Event is a change delivered to the webhooks as the JSON request body
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// DeadLetter is an event that could not be delivered to a webhook
+type DeadLetter struct {
+	Event     Event     `json:"event"`
+	Target    string    `json:"target"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// Dispatcher delivers events to the configured webhooks. Each event is
+// POSTed to every URL and retried with exponential backoff until a 2xx
+// response, so webhooks receive every event at least once unless all
+// attempts fail.
+type Dispatcher interface {
+	// Publish queues an event with data as its payload. It never blocks on
+	// delivery and does nothing when no webhooks are configured.
+	Publish(eventType string, data interface{})
+	// DeadLetters returns the deliveries that failed every attempt, oldest
+	// first
+	DeadLetters() []DeadLetter
+	// InFlight returns the number of deliveries that have neither
+	// succeeded nor been dead-lettered
+	InFlight() int
+}
+
+type dispatcher struct {
+	cfg    Config
+	logger *slog.Logger
+	ids    idgen.Generator
+	clock  clock.Clock
+	client *http.Client
+	pool   workers.Pool
+
+	// ctx is cancelled on stop to abandon pending retries, and wg tracks
+	// the deliveries waiting to retry
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu          sync.Mutex
+	inFlight    map[string]struct{}
+	deadLetters []DeadLetter
+	// stopped is set on stop, before waiting on wg, so no retry is added
+	// to wg once the wait has begun
+	stopped bool
+}
+
+// newDispatcher creates the webhook dispatcher
+func newDispatcher(lc cell.Lifecycle, cfg Config, logger *slog.Logger, ids idgen.Generator, clk clock.Clock, pool workers.Pool) (Dispatcher, error) {
+	for _, target := range cfg.URLs {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook-urls: %q is not an http or https URL", target)
+		}
+	}
+	if cfg.MaxAttempts < 1 {
+		return nil, fmt.Errorf("webhook-max-attempts must be at least 1, got %d", cfg.MaxAttempts)
+	}
+	if cfg.Backoff <= 0 || cfg.MaxBackoff < cfg.Backoff {
+		return nil, fmt.Errorf("webhook-backoff must be positive and at most webhook-max-backoff, got %v and %v", cfg.Backoff, cfg.MaxBackoff)
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("webhook-timeout must be positive, got %v", cfg.Timeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &dispatcher{
+		cfg:      cfg,
+		logger:   logger.With("component", "webhooks"),
+		ids:      ids,
+		clock:    clk,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		pool:     pool,
+		ctx:      ctx,
+		cancel:   cancel,
+		inFlight: make(map[string]struct{}),
+	}
+
+	lc.Append(cell.Hook{
+		OnStart: func(ctx cell.HookContext) error {
+			if len(cfg.URLs) > 0 {
+				d.logger.Info("Webhooks enabled", "urls", cfg.URLs, "max_attempts", cfg.MaxAttempts)
+			}
+			return nil
+		},
+		OnStop: func(ctx cell.HookContext) error {
+			d.mu.Lock()
+			d.stopped = true
+			d.mu.Unlock()
+			d.cancel()
+			d.wg.Wait()
+			if pending := d.InFlight(); pending > 0 {
+				d.logger.Warn("Webhook deliveries abandoned", "pending", pending)
+			}
+			return nil
+		},
+	})
+
+	return d, nil
+}
+
+func (d *dispatcher) Publish(eventType string, data interface{}) {
+	if len(d.cfg.URLs) == 0 {
+		return
+	}
+
+	event := Event{
+		ID:   "evt-" + d.ids.NewID(),
+		Type: eventType,
+		Time: d.clock.Now().UTC(),
+	}
+	// Encode now so later changes to data are not delivered
+	payload, err := json.Marshal(data)
+	if err != nil {
+		d.logger.Error("Webhook event not encodable", "type", eventType, "error", err)
+		return
+	}
+	event.Data = payload
+	body, err := json.Marshal(event)
+	if err != nil {
+		d.logger.Error("Webhook event not encodable", "type", eventType, "error", err)
+		return
+	}
+
+	for _, target := range d.cfg.URLs {
+		key := event.ID + " " + target
+
+		d.mu.Lock()
+		full := len(d.inFlight) >= maxInFlight
+		if !full {
+			d.inFlight[key] = struct{}{}
+		}
+		d.mu.Unlock()
+
+		if full {
+			d.logger.Warn("Webhook queue full", "target", target, "event", event.ID)
+			d.deadLetter(event, target, 0, "too many deliveries in flight")
+			continue
+		}
+
+		d.enqueue(delivery{event: event, target: target, body: body, key: key, attempt: 1})
+	}
+}
+
+// delivery is one attempt to deliver an event to a target
+type delivery struct {
+	event   Event
+	target  string
+	body    []byte
+	key     string
+	attempt int
+}
+
+// enqueue hands an attempt to the worker pool, dead-lettering the event if
+// the pool rejects it
+func (d *dispatcher) enqueue(del delivery) {
+	err := d.pool.Submit(func(context.Context) { d.deliver(del) })
+	if err == nil {
+		return
+	}
+
+	d.logger.Warn("Webhook delivery rejected", "target", del.target, "event", del.event.ID, "attempt", del.attempt, "error", err)
+	d.done(del.key)
+	d.deadLetter(del.event, del.target, del.attempt-1, err.Error())
+}
+
+// deliver makes one attempt to POST the event and schedules the next one
+// if it fails. A delivery abandoned on stop stays in flight.
+func (d *dispatcher) deliver(del delivery) {
+	if d.ctx.Err() != nil {
+		return
+	}
+
+	status, err := d.post(del.event, del.target, del.body, del.attempt)
+	if err == nil {
+		d.logger.Info("Webhook delivered", "target", del.target, "event", del.event.ID, "status", status, "attempt", del.attempt)
+		d.done(del.key)
+		return
+	}
+	if d.ctx.Err() != nil {
+		return
+	}
+	d.logger.Warn("Webhook delivery failed", "target", del.target, "event", del.event.ID, "status", status, "attempt", del.attempt, "error", err)
+
+	if del.attempt == d.cfg.MaxAttempts {
+		d.logger.Error("Webhook delivery gave up", "target", del.target, "event", del.event.ID, "attempts", d.cfg.MaxAttempts)
+		d.done(del.key)
+		d.deadLetter(del.event, del.target, d.cfg.MaxAttempts, err.Error())
+		return
+	}
+
+	// Wait for the backoff off the pool, so failing targets do not hold
+	// up the workers
+	delay := d.backoff(del.attempt)
+	del.attempt++
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	d.wg.Add(1)
+	d.mu.Unlock()
+	go func() {
+		defer d.wg.Done()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-d.ctx.Done():
+		case <-timer.C:
+			d.enqueue(del)
+		}
+	}()
+}
+
+// done removes a delivery that succeeded or was given up from those in
+// flight
+func (d *dispatcher) done(key string) {
+	d.mu.Lock()
+	delete(d.inFlight, key)
+	d.mu.Unlock()
+}
+
+// post makes one delivery attempt, returning the response status, or 0 if
+// there was no response
+func (d *dispatcher) post(event Event, target string, body []byte, attempt int) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Delivery", event.ID)
+	req.Header.Set("X-Webhook-Attempt", fmt.Sprint(attempt))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given number of failed attempts
+func (d *dispatcher) backoff(failures int) time.Duration {
+	delay := d.cfg.Backoff
+	for i := 1; i < failures && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.cfg.MaxBackoff)
+}
+
+func (d *dispatcher) deadLetter(event Event, target string, attempts int, lastErr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.deadLetters) == maxDeadLetters {
+		d.deadLetters = d.deadLetters[1:]
+	}
+	d.deadLetters = append(d.deadLetters, DeadLetter{
+		Event:     event,
+		Target:    target,
+		Attempts:  attempts,
+		LastError: lastErr,
+		FailedAt:  d.clock.Now().UTC(),
+	})
+}
+
+func (d *dispatcher) DeadLetters() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DeadLetter(nil), d.deadLetters...)
+}
+
+func (d *dispatcher) InFlight() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.inFlight)
+}
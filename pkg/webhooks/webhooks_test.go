@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/clock"
+	"github.com/bhargavparmar/hive-demo/pkg/idgen"
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+	"github.com/bhargavparmar/hive-demo/pkg/workers"
+	"github.com/cilium/hive"
+	"github.com/cilium/hive/cell"
+)
+
+func TestStopWhileRetrying(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Stop while deliveries are failing and scheduling retries as fast as
+	// they can, so that some are scheduled while stop waits for the others
+	for range 20 {
+		var d Dispatcher
+		h := hive.New(
+			idgen.Cell,
+			clock.Cell,
+			metrics.Cell,
+			workers.Cell,
+			Cell,
+			cell.Invoke(func(dispatcher Dispatcher) { d = dispatcher }),
+		)
+		hive.AddConfigOverride(h, func(cfg *Config) {
+			cfg.URLs = []string{failing.URL}
+			cfg.MaxAttempts = 1000
+			cfg.Backoff = time.Microsecond
+			cfg.MaxBackoff = time.Microsecond
+		})
+		if err := h.Start(log, context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for range 20 {
+			d.Publish("task.created", map[string]string{"id": "task"})
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		if err := h.Stop(log, context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
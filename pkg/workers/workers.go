@@ -0,0 +1,187 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bhargavparmar/hive-demo/pkg/metrics"
+	"github.com/cilium/hive/cell"
+	"github.com/spf13/pflag"
+)
+
+// Cell provides a shared pool of workers that run jobs off the request
+// goroutine
+var Cell = cell.Module(
+	"workers",
+	"Worker Pool",
+
+	cell.Config(defaultConfig),
+	metrics.TimeHooks(
+		cell.Provide(newPool),
+	),
+)
+
+// Config holds worker pool configuration
+type Config struct {
+	Count        int           `mapstructure:"worker-count"`
+	QueueSize    int           `mapstructure:"worker-queue-size"`
+	DrainTimeout time.Duration `mapstructure:"worker-drain-timeout"`
+}
+
+var defaultConfig = Config{
+	Count:        4,
+	QueueSize:    1000,
+	DrainTimeout: 5 * time.Second,
+}
+
+// Flags implements cell.Flagger
+func (c Config) Flags(flags *pflag.FlagSet) {
+	flags.Int("worker-count", c.Count, "Number of workers running background jobs, such as webhook deliveries")
+	flags.Int("worker-queue-size", c.QueueSize, "Maximum jobs waiting for a worker; further jobs are rejected")
+	flags.Duration("worker-drain-timeout", c.DrainTimeout, "Maximum time to finish the queued jobs on shutdown before the rest are cancelled")
+}
+
+var (
+	// ErrQueueFull is returned when a job is submitted while the queue is
+	// full
+	ErrQueueFull = errors.New("worker queue is full")
+	// ErrStopped is returned when a job is submitted after the pool has
+	// stopped
+	ErrStopped = errors.New("worker pool is stopped")
+)
+
+// Job is work run by the pool. ctx is cancelled if the pool stops before the
+// job finishes.
+type Job func(ctx context.Context)
+
+// Pool runs jobs on a fixed number of workers
+type Pool interface {
+	// Submit queues a job without waiting. A job that does not fit in the
+	// queue is rejected with ErrQueueFull and counted in the metrics.
+	Submit(job Job) error
+	// Queued returns the number of jobs waiting for a worker
+	Queued() int
+}
+
+type pool struct {
+	cfg     Config
+	logger  *slog.Logger
+	metrics metrics.Metrics
+
+	// ctx is cancelled once the drain timeout passes
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// mu guards closing the queue against concurrent submits
+	mu     sync.RWMutex
+	queue  chan Job
+	closed bool
+}
+
+// newPool creates the pool; its workers run from start to stop
+func newPool(lc cell.Lifecycle, cfg Config, logger *slog.Logger, m metrics.Metrics) (Pool, error) {
+	if cfg.Count < 1 {
+		return nil, fmt.Errorf("worker-count must be at least 1, got %d", cfg.Count)
+	}
+	if cfg.QueueSize < 0 {
+		return nil, fmt.Errorf("worker-queue-size must not be negative, got %d", cfg.QueueSize)
+	}
+	if cfg.DrainTimeout <= 0 {
+		return nil, fmt.Errorf("worker-drain-timeout must be positive, got %s", cfg.DrainTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &pool{
+		cfg:     cfg,
+		logger:  logger.With("component", "workers"),
+		metrics: m,
+		ctx:     ctx,
+		cancel:  cancel,
+		queue:   make(chan Job, cfg.QueueSize),
+	}
+
+	lc.Append(cell.Hook{
+		OnStart: func(ctx cell.HookContext) error {
+			for range cfg.Count {
+				p.wg.Add(1)
+				go p.work()
+			}
+			p.logger.Info("Worker pool started", "workers", cfg.Count, "queue_size", cfg.QueueSize)
+			return nil
+		},
+		OnStop: func(ctx cell.HookContext) error {
+			p.mu.Lock()
+			p.closed = true
+			close(p.queue)
+			p.mu.Unlock()
+
+			done := make(chan struct{})
+			go func() {
+				p.wg.Wait()
+				close(done)
+			}()
+
+			timer := time.NewTimer(cfg.DrainTimeout)
+			defer timer.Stop()
+			select {
+			case <-done:
+				p.logger.Info("Worker pool drained")
+			case <-timer.C:
+				p.logger.Warn("Worker pool not drained in time; cancelling jobs", "queued", len(p.queue))
+				p.cancel()
+				<-done
+			}
+			p.cancel()
+			return nil
+		},
+	})
+
+	return p, nil
+}
+
+// work runs queued jobs until the queue is closed and empty. Once the pool
+// is cancelled the remaining jobs still run, with a cancelled context, so
+// they can release what they hold.
+func (p *pool) work() {
+	defer p.wg.Done()
+	for job := range p.queue {
+		p.run(job)
+	}
+}
+
+// run runs a job, logging rather than propagating a panic so the worker
+// survives
+func (p *pool) run(job Job) {
+	defer func() {
+		if v := recover(); v != nil {
+			p.logger.Error("Job panicked", "panic", v)
+		}
+	}()
+	job(p.ctx)
+}
+
+func (p *pool) Submit(job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.metrics.IncrementRejectedJobs()
+		return ErrStopped
+	}
+	select {
+	case p.queue <- job:
+		return nil
+	default:
+		p.metrics.IncrementRejectedJobs()
+		return ErrQueueFull
+	}
+}
+
+func (p *pool) Queued() int {
+	return len(p.queue)
+}